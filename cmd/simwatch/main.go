@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -32,7 +33,23 @@ func main() {
 	}
 	logrus.SetLevel(level)
 
-	s := simwatch.NewServer(cfg)
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "tracks":
+			err = runTracks(cfg, flag.Args()[1:])
+		default:
+			err = fmt.Errorf("unknown command '%s'", flag.Arg(0))
+		}
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	s, err := simwatch.NewServer(cfg)
+	if err != nil {
+		logrus.Fatal(err)
+	}
 
 	go s.Start()
 
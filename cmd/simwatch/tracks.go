@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/provider"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const tracksUsage = `usage: simwatch [-c config] tracks <command> [options]
+
+commands:
+  copy -to <config>   copy all tracks from the configured engine to the
+                      engine configured in another config
+  dump [-o <file>]    dump all tracks to a file, stdout by default
+  restore [-i <file>] restore tracks from a dump, stdin by default
+
+the memory engine keeps tracks in the running server only and can't be used
+`
+
+// runTracks implements the "tracks" subcommand which moves track
+// history between engines and backs it up
+func runTracks(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, tracksUsage)
+		return fmt.Errorf("tracks command is missing")
+	}
+
+	ctx := context.Background()
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "copy":
+		fs := flag.NewFlagSet("copy", flag.ExitOnError)
+		dstConfigName := fs.String("to", "", "destination config name")
+		fs.Parse(args)
+
+		if *dstConfigName == "" {
+			return fmt.Errorf("destination config is required")
+		}
+
+		dstCfg, err := config.Read(*dstConfigName)
+		if err != nil {
+			return err
+		}
+		if sameTrackStorage(&cfg.Track, &dstCfg.Track) {
+			return fmt.Errorf("source and destination are the same %s storage", cfg.Track.Engine)
+		}
+
+		src, err := openTrackEngine(&cfg.Track)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := openTrackEngine(&dstCfg.Track)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		count, err := track.Copy(ctx, src, dst)
+		logrus.WithField("count", count).Info("tracks copied")
+		return err
+
+	case "dump":
+		fs := flag.NewFlagSet("dump", flag.ExitOnError)
+		filename := fs.String("o", "-", "output file")
+		fs.Parse(args)
+
+		src, err := openTrackEngine(&cfg.Track)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		if *filename == "-" {
+			count, err := track.Dump(ctx, src, os.Stdout)
+			logrus.WithField("count", count).Info("tracks dumped")
+			return err
+		}
+
+		out, err := os.Create(*filename)
+		if err != nil {
+			return err
+		}
+		count, err := track.Dump(ctx, src, out)
+		// a failed close may lose the buffered end of the dump
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+		logrus.WithField("count", count).Info("tracks dumped")
+		return err
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		filename := fs.String("i", "-", "input file")
+		fs.Parse(args)
+
+		dst, err := openTrackEngine(&cfg.Track)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		var in io.ReadCloser = os.Stdin
+		if *filename != "-" {
+			in, err = os.Open(*filename)
+			if err != nil {
+				return err
+			}
+		}
+		defer in.Close()
+
+		count, err := track.Restore(ctx, in, dst)
+		logrus.WithField("count", count).Info("tracks restored")
+		return err
+
+	default:
+		fmt.Fprint(os.Stderr, tracksUsage)
+		return fmt.Errorf("unknown tracks command '%s'", cmd)
+	}
+}
+
+// openTrackEngine creates a dedicated engine instance so that
+// two storages of the same engine may be opened at once
+func openTrackEngine(tcfg *config.TrackConfig) (track.TrackReadWriter, error) {
+	if tcfg.Engine == "memory" {
+		// a fresh memory engine is always empty and is gone on exit
+		return nil, fmt.Errorf("memory track engine can't be used here, its tracks live in the running server only")
+	}
+
+	trw, err := provider.NewTrackEngine(tcfg.Engine)
+	if err != nil {
+		return nil, err
+	}
+	err = trw.Configure(&tcfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring %s track engine: %w", tcfg.Engine, err)
+	}
+	return trw, nil
+}
+
+// sameTrackStorage checks if two configs point to the same storage
+func sameTrackStorage(a, b *config.TrackConfig) bool {
+	if a.Engine != b.Engine {
+		return false
+	}
+	switch a.Engine {
+	case "redis":
+		return a.Options.Addr == b.Options.Addr && a.Options.DB == b.Options.DB
+	case "sqlite":
+		return filepath.Clean(a.Options.Path) == filepath.Clean(b.Options.Path)
+	}
+	return true
+}
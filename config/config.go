@@ -20,6 +20,16 @@ type TrackConfigOptions struct {
 	DB          int           `mapstructure:"db,omitempty"`
 	Path        string        `mapstructure:"path,omitempty"`
 	PurgePeriod time.Duration `mapstructure:"purge_period,omitempty"`
+
+	// QueueSize and WriteTimeout tune the track writer,
+	// zero values pick the writer defaults
+	QueueSize    int           `mapstructure:"queue_size,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout,omitempty"`
+
+	// CompressTolerance is the max lateral deviation in nautical miles
+	// for a point to be dropped as lying on a straight line, 0 disables
+	// straight line compression
+	CompressTolerance float64 `mapstructure:"compress_tolerance,omitempty"`
 }
 
 type TrackConfig struct {
@@ -27,13 +37,181 @@ type TrackConfig struct {
 	Options TrackConfigOptions `mapstructure:"options,omitempty"`
 }
 
+// WebhookSubscription delivers events of a given type, optionally
+// narrowed down by a pilot query and an airport ICAO code
+type WebhookSubscription struct {
+	URL     string `mapstructure:"url,omitempty"`
+	Event   string `mapstructure:"event,omitempty"`
+	Pilot   string `mapstructure:"pilot,omitempty"`
+	Airport string `mapstructure:"airport,omitempty"`
+	Secret  string `mapstructure:"secret,omitempty"`
+}
+
+type WebhooksConfig struct {
+	Subscriptions []WebhookSubscription `mapstructure:"subscriptions,omitempty"`
+	Workers       int                   `mapstructure:"workers,omitempty"`
+	Timeout       time.Duration         `mapstructure:"timeout,omitempty"`
+	MaxRetries    int                   `mapstructure:"max_retries,omitempty"`
+	RetryBackoff  time.Duration         `mapstructure:"retry_backoff,omitempty"`
+	// DeadLetter is a file failed deliveries are appended to
+	DeadLetter string `mapstructure:"dead_letter,omitempty"`
+}
+
+type MQTTConfig struct {
+	Enabled  bool   `mapstructure:"enabled,omitempty"`
+	Broker   string `mapstructure:"broker,omitempty"`
+	ClientID string `mapstructure:"client_id,omitempty"`
+	Username string `mapstructure:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty"`
+	// Prefix is the root of the topic hierarchy
+	Prefix              string        `mapstructure:"prefix,omitempty"`
+	QoS                 byte          `mapstructure:"qos,omitempty"`
+	Timeout             time.Duration `mapstructure:"timeout,omitempty"`
+	IncludeUncontrolled bool          `mapstructure:"include_uncontrolled,omitempty"`
+}
+
+// RecorderConfig configures recording of provider update batches,
+// files are rotated every RotatePeriod and removed after Retention
+type RecorderConfig struct {
+	Enabled      bool          `mapstructure:"enabled,omitempty"`
+	Dir          string        `mapstructure:"dir,omitempty"`
+	RotatePeriod time.Duration `mapstructure:"rotate_period,omitempty"`
+	Retention    time.Duration `mapstructure:"retention,omitempty"`
+	QueueSize    int           `mapstructure:"queue_size,omitempty"`
+}
+
+type ReplaySourceConfig struct {
+	// Dir holds recordings made by the recorder
+	Dir string `mapstructure:"dir,omitempty"`
+	// Speed is the playback speed factor, 1 is real time
+	Speed float64 `mapstructure:"speed,omitempty"`
+	Loop  bool    `mapstructure:"loop,omitempty"`
+}
+
+// Hotspot attracts a share of synthetic flights to airports
+// within RadiusNM of its center
+type Hotspot struct {
+	Lat      float64 `mapstructure:"lat,omitempty"`
+	Lng      float64 `mapstructure:"lng,omitempty"`
+	RadiusNM float64 `mapstructure:"radius_nm,omitempty"`
+	Weight   float64 `mapstructure:"weight,omitempty"`
+}
+
+type SyntheticSourceConfig struct {
+	Pilots       int           `mapstructure:"pilots,omitempty"`
+	Controllers  int           `mapstructure:"controllers,omitempty"`
+	UpdatePeriod time.Duration `mapstructure:"update_period,omitempty"`
+	// ControllerChurn is a share of controller positions
+	// closing and opening elsewhere every update
+	ControllerChurn float64 `mapstructure:"controller_churn,omitempty"`
+	// HotspotShare is a share of airports picked from hotspots,
+	// the rest are picked uniformly across the world
+	HotspotShare float64   `mapstructure:"hotspot_share,omitempty"`
+	Hotspots     []Hotspot `mapstructure:"hotspots,omitempty"`
+	// Seed makes generated traffic reproducible, 0 means random
+	Seed int64 `mapstructure:"seed,omitempty"`
+}
+
+// SourceConfig selects where provider data comes from, "live" polls
+// VATSIM and static data urls, "replay" plays recordings back and
+// "synthetic" generates fake traffic around real airports
+type SourceConfig struct {
+	Mode      string                `mapstructure:"mode,omitempty"`
+	Replay    ReplaySourceConfig    `mapstructure:"replay,omitempty"`
+	Synthetic SyntheticSourceConfig `mapstructure:"synthetic,omitempty"`
+}
+
+// SnapshotConfig configures provider state snapshots used to
+// warm start after restarts, snapshots older than MaxAge are ignored
+type SnapshotConfig struct {
+	Enabled  bool          `mapstructure:"enabled,omitempty"`
+	Path     string        `mapstructure:"path,omitempty"`
+	Interval time.Duration `mapstructure:"interval,omitempty"`
+	MaxAge   time.Duration `mapstructure:"max_age,omitempty"`
+}
+
+// FreshnessConfig controls data staleness reporting, objects not
+// refreshed within StalePolls source update periods are flagged stale
+type FreshnessConfig struct {
+	StalePolls     int           `mapstructure:"stale_polls,omitempty"`
+	StatusInterval time.Duration `mapstructure:"status_interval,omitempty"`
+}
+
+// ConflictsConfig configures proximity detection between airborne
+// pilots. Pilots near airports below AirportMaxAltitude are ignored
+// as parallel approaches and departures aren't conflicts.
+type ConflictsConfig struct {
+	Enabled            bool    `mapstructure:"enabled,omitempty"`
+	LateralNM          float64 `mapstructure:"lateral_nm,omitempty"`
+	VerticalFt         int     `mapstructure:"vertical_ft,omitempty"`
+	AirportRadiusNM    float64 `mapstructure:"airport_radius_nm,omitempty"`
+	AirportMaxAltitude int     `mapstructure:"airport_max_altitude,omitempty"`
+}
+
+// ActiveRunwaysConfig configures inference of active runways from
+// takeoffs and landings within Window. Confidence reaches its maximum
+// once an airport has ConfidentOps operations of the kind.
+type ActiveRunwaysConfig struct {
+	Enabled      bool          `mapstructure:"enabled,omitempty"`
+	Window       time.Duration `mapstructure:"window,omitempty"`
+	ConfidentOps int           `mapstructure:"confident_ops,omitempty"`
+}
+
+// HeatmapConfig limits density grid queries, averaged grids sample
+// stored tracks every SampleInterval over at most MaxHours and are
+// pushed to websocket subscribers every HistoryRefresh
+type HeatmapConfig struct {
+	MaxCells       int           `mapstructure:"max_cells,omitempty"`
+	MaxHours       float64       `mapstructure:"max_hours,omitempty"`
+	SampleInterval time.Duration `mapstructure:"sample_interval,omitempty"`
+	HistoryRefresh time.Duration `mapstructure:"history_refresh,omitempty"`
+}
+
+// StatsRetention is how long points of every rollup are kept
+type StatsRetention struct {
+	Minute time.Duration `mapstructure:"minute,omitempty"`
+	Hour   time.Duration `mapstructure:"hour,omitempty"`
+	Day    time.Duration `mapstructure:"day,omitempty"`
+}
+
+// StatsConfig configures network statistics sampled every data cycle
+// and rolled up to minutes, hours and days. Series are kept in memory
+// and saved to Path every SaveInterval, TopN limits airport and
+// aircraft type rankings.
+type StatsConfig struct {
+	Enabled      bool           `mapstructure:"enabled,omitempty"`
+	Path         string         `mapstructure:"path,omitempty"`
+	SaveInterval time.Duration  `mapstructure:"save_interval,omitempty"`
+	TopN         int            `mapstructure:"top_n,omitempty"`
+	Retention    StatsRetention `mapstructure:"retention,omitempty"`
+}
+
+// RoutesConfig configures expansion of filed routes. Navdata is an
+// optional file with fixes and airways, without it only airports and
+// coordinates are resolved. Polyline legs are split every PolylineStepNM.
+type RoutesConfig struct {
+	Navdata        string  `mapstructure:"navdata,omitempty"`
+	PolylineStepNM float64 `mapstructure:"polyline_step_nm,omitempty"`
+}
+
 type Config struct {
-	API      vatsimapi.Config   `mapstructure:"api,omitempty"`
-	Data     vatspydata.Config  `mapstructure:"data,omitempty"`
-	Runways  ourairports.Config `mapstructure:"runways,omitempty"`
-	LogLevel string             `mapstructure:"log_level,omitempty"`
-	Web      WebConfig          `mapstructure:"web,omitempty"`
-	Track    TrackConfig        `mapstructure:"track,omitempty"`
+	API           vatsimapi.Config    `mapstructure:"api,omitempty"`
+	Data          vatspydata.Config   `mapstructure:"data,omitempty"`
+	Runways       ourairports.Config  `mapstructure:"runways,omitempty"`
+	LogLevel      string              `mapstructure:"log_level,omitempty"`
+	Web           WebConfig           `mapstructure:"web,omitempty"`
+	Track         TrackConfig         `mapstructure:"track,omitempty"`
+	Webhooks      WebhooksConfig      `mapstructure:"webhooks,omitempty"`
+	MQTT          MQTTConfig          `mapstructure:"mqtt,omitempty"`
+	Recorder      RecorderConfig      `mapstructure:"recorder,omitempty"`
+	Source        SourceConfig        `mapstructure:"source,omitempty"`
+	Snapshot      SnapshotConfig      `mapstructure:"snapshot,omitempty"`
+	Freshness     FreshnessConfig     `mapstructure:"freshness,omitempty"`
+	Conflicts     ConflictsConfig     `mapstructure:"conflicts,omitempty"`
+	ActiveRunways ActiveRunwaysConfig `mapstructure:"active_runways,omitempty"`
+	Heatmap       HeatmapConfig       `mapstructure:"heatmap,omitempty"`
+	Stats         StatsConfig         `mapstructure:"stats,omitempty"`
+	Routes        RoutesConfig        `mapstructure:"routes,omitempty"`
 }
 
 func Read(filename string) (*Config, error) {
@@ -71,6 +249,72 @@ func Read(filename string) (*Config, error) {
 	viper.SetDefault("track.options.addr", "localhost:6379")
 	viper.SetDefault("track.options.password", "")
 	viper.SetDefault("track.options.db", 0)
+	viper.SetDefault("track.options.compress_tolerance", 0.0)
+
+	viper.SetDefault("webhooks.workers", 4)
+	viper.SetDefault("webhooks.timeout", 5*time.Second)
+	viper.SetDefault("webhooks.max_retries", 5)
+	viper.SetDefault("webhooks.retry_backoff", 2*time.Second)
+	viper.SetDefault("webhooks.dead_letter", "webhooks.dead.jsonl")
+
+	viper.SetDefault("mqtt.enabled", false)
+	viper.SetDefault("mqtt.broker", "tcp://localhost:1883")
+	viper.SetDefault("mqtt.client_id", "simwatch")
+	viper.SetDefault("mqtt.prefix", "simwatch")
+	viper.SetDefault("mqtt.qos", 0)
+	viper.SetDefault("mqtt.timeout", 5*time.Second)
+	viper.SetDefault("mqtt.include_uncontrolled", false)
+
+	viper.SetDefault("recorder.enabled", false)
+	viper.SetDefault("recorder.dir", "recordings")
+	viper.SetDefault("recorder.rotate_period", time.Hour)
+	viper.SetDefault("recorder.retention", 7*24*time.Hour)
+	viper.SetDefault("recorder.queue_size", 64)
+
+	viper.SetDefault("source.mode", "live")
+	viper.SetDefault("source.replay.dir", "recordings")
+	viper.SetDefault("source.replay.speed", 1.0)
+	viper.SetDefault("source.replay.loop", false)
+	viper.SetDefault("source.synthetic.pilots", 500)
+	viper.SetDefault("source.synthetic.controllers", 50)
+	viper.SetDefault("source.synthetic.update_period", 15*time.Second)
+	viper.SetDefault("source.synthetic.controller_churn", 0.02)
+	viper.SetDefault("source.synthetic.hotspot_share", 0.5)
+	viper.SetDefault("source.synthetic.seed", 0)
+
+	viper.SetDefault("snapshot.enabled", false)
+	viper.SetDefault("snapshot.path", "simwatch.snapshot.json.gz")
+	viper.SetDefault("snapshot.interval", time.Minute)
+	viper.SetDefault("snapshot.max_age", time.Hour)
+
+	viper.SetDefault("freshness.stale_polls", 3)
+	viper.SetDefault("freshness.status_interval", 30*time.Second)
+
+	viper.SetDefault("conflicts.enabled", true)
+	viper.SetDefault("conflicts.lateral_nm", 5.0)
+	viper.SetDefault("conflicts.vertical_ft", 1000)
+	viper.SetDefault("conflicts.airport_radius_nm", 10.0)
+	viper.SetDefault("conflicts.airport_max_altitude", 5000)
+
+	viper.SetDefault("active_runways.enabled", true)
+	viper.SetDefault("active_runways.window", 30*time.Minute)
+	viper.SetDefault("active_runways.confident_ops", 5)
+
+	viper.SetDefault("heatmap.max_cells", 100000)
+	viper.SetDefault("heatmap.max_hours", 24.0)
+	viper.SetDefault("heatmap.sample_interval", time.Minute)
+	viper.SetDefault("heatmap.history_refresh", 5*time.Minute)
+
+	viper.SetDefault("stats.enabled", true)
+	viper.SetDefault("stats.path", "simwatch.stats.json.gz")
+	viper.SetDefault("stats.save_interval", 5*time.Minute)
+	viper.SetDefault("stats.top_n", 10)
+	viper.SetDefault("stats.retention.minute", 24*time.Hour)
+	viper.SetDefault("stats.retention.hour", 30*24*time.Hour)
+	viper.SetDefault("stats.retention.day", 365*24*time.Hour)
+
+	viper.SetDefault("routes.navdata", "")
+	viper.SetDefault("routes.polyline_step_nm", 100.0)
 
 	err = viper.ReadInConfig()
 	if err != nil {
@@ -0,0 +1,71 @@
+package geo
+
+import (
+	"math"
+
+	"github.com/vatsimnerd/geoidx"
+)
+
+// BoundingBox is the smallest rect containing every point within
+// radiusNM of the center. The rect spans all longitudes if a pole
+// is within the radius and has SW longitude greater than NE one if
+// it crosses the antimeridian.
+func BoundingBox(lat, lng, radiusNM float64) geoidx.Rect {
+	delta := radiusNM / EarthRadiusNM
+	minLat := lat - toDeg(delta)
+	maxLat := lat + toDeg(delta)
+	if maxLat >= 90 || minLat <= -90 {
+		return geoidx.MakeRect(-180, math.Max(minLat, -90), 180, math.Min(maxLat, 90))
+	}
+
+	// the widest point of a circle on a sphere isn't at the center
+	// latitude, this is the exact longitude extent
+	ratio := math.Sin(delta) / math.Cos(toRad(lat))
+	if ratio >= 1 {
+		return geoidx.MakeRect(-180, minLat, 180, maxLat)
+	}
+	dLng := toDeg(math.Asin(ratio))
+	return geoidx.MakeRect(NormalizeLng(lng-dLng), minLat, NormalizeLng(lng+dLng), maxLat)
+}
+
+// ObjectBox is a bounding box usable as an index object footprint,
+// index rects can't cross the antimeridian so the box is cut at it
+// on the side of the center
+func ObjectBox(lat, lng, radiusNM float64) geoidx.Rect {
+	rects := SplitRect(BoundingBox(lat, lng, radiusNM))
+	if len(rects) == 1 {
+		return rects[0]
+	}
+	lng = NormalizeLng(lng)
+	if lng >= rects[0].SouthWest.Longitude {
+		return rects[0]
+	}
+	return rects[1]
+}
+
+// SplitRect wraps longitudes into [-180, 180] and splits a rect
+// crossing the antimeridian in two. Both SW longitude greater than NE
+// one and longitudes beyond ±180 mean crossing, a rect 360 degrees wide
+// or more spans all longitudes.
+func SplitRect(rect geoidx.Rect) []geoidx.Rect {
+	minLat := math.Max(rect.SouthWest.Latitude, -90)
+	maxLat := math.Min(rect.NorthEast.Latitude, 90)
+
+	width := rect.NorthEast.Longitude - rect.SouthWest.Longitude
+	if width < 0 {
+		width += 360
+	}
+	if width >= 360 {
+		return []geoidx.Rect{geoidx.MakeRect(-180, minLat, 180, maxLat)}
+	}
+
+	west := NormalizeLng(rect.SouthWest.Longitude)
+	east := west + width
+	if east <= 180 {
+		return []geoidx.Rect{geoidx.MakeRect(west, minLat, east, maxLat)}
+	}
+	return []geoidx.Rect{
+		geoidx.MakeRect(west, minLat, 180, maxLat),
+		geoidx.MakeRect(-180, minLat, east-360, maxLat),
+	}
+}
@@ -0,0 +1,170 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vatsimnerd/geoidx"
+)
+
+const testEpsilon = 1e-3
+
+func rectEqual(a, b geoidx.Rect) bool {
+	return math.Abs(a.SouthWest.Latitude-b.SouthWest.Latitude) < testEpsilon &&
+		math.Abs(a.SouthWest.Longitude-b.SouthWest.Longitude) < testEpsilon &&
+		math.Abs(a.NorthEast.Latitude-b.NorthEast.Latitude) < testEpsilon &&
+		math.Abs(a.NorthEast.Longitude-b.NorthEast.Longitude) < testEpsilon
+}
+
+func rectContains(rect geoidx.Rect, lat, lng float64) bool {
+	for _, r := range SplitRect(rect) {
+		if lat >= r.SouthWest.Latitude-testEpsilon && lat <= r.NorthEast.Latitude+testEpsilon &&
+			lng >= r.SouthWest.Longitude-testEpsilon && lng <= r.NorthEast.Longitude+testEpsilon {
+			return true
+		}
+	}
+	return false
+}
+
+// degrees of latitude 60 nm span, close to but not exactly one
+var deg60NM = toDeg(60 / EarthRadiusNM)
+
+func TestBoundingBox(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radiusNM float64
+		expected geoidx.Rect
+	}{
+		{"equator", 0, 0, 60, geoidx.MakeRect(-deg60NM, -deg60NM, deg60NM, deg60NM)},
+		{"north pole within", 89.5, 30, 60, geoidx.MakeRect(-180, 89.5-deg60NM, 180, 90)},
+		{"south pole within", -89.9, -120, 30, geoidx.MakeRect(-180, -90, 180, -89.9+deg60NM/2)},
+		{"at the pole", 90, 0, 1, geoidx.MakeRect(-180, 90-deg60NM/60, 180, 90)},
+		{"crossing antimeridian east", 0, 179.9, 60, geoidx.MakeRect(179.9-deg60NM, -deg60NM, -360+179.9+deg60NM, deg60NM)},
+		{"crossing antimeridian west", 0, -179.9, 60, geoidx.MakeRect(360-179.9-deg60NM, -deg60NM, -179.9+deg60NM, deg60NM)},
+		{"huge radius", 10, 10, 20000, geoidx.MakeRect(-180, -90, 180, 90)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BoundingBox(tt.lat, tt.lng, tt.radiusNM)
+			if !rectEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBoundingBoxContainsCircle(t *testing.T) {
+	centers := [][2]float64{
+		{0, 0}, {60, 10}, {88, 0}, {-88, 179}, {89.99, -179.99},
+		{45, 179.5}, {-45, -179.5}, {70, 180}, {-70, -180},
+	}
+	for _, c := range centers {
+		for _, radius := range []float64{5, 60, 300} {
+			box := BoundingBox(c[0], c[1], radius)
+			for brg := 0.0; brg < 360; brg += 5 {
+				lat, lng := Destination(c[0], c[1], brg, radius)
+				if !rectContains(box, lat, lng) {
+					t.Fatalf("box %v around %v r=%v misses %v, %v", box, c, radius, lat, lng)
+				}
+			}
+		}
+	}
+}
+
+func TestObjectBox(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radiusNM float64
+		expected geoidx.Rect
+	}{
+		{"regular", 50, 10, 0, geoidx.MakeRect(10, 50, 10, 50)},
+		{"east of antimeridian", 0, 179.9, 60, geoidx.MakeRect(179.9-deg60NM, -deg60NM, 180, deg60NM)},
+		{"west of antimeridian", 0, -179.9, 60, geoidx.MakeRect(-180, -deg60NM, -179.9+deg60NM, deg60NM)},
+		{"on antimeridian", 0, 180, 60, geoidx.MakeRect(-180, -deg60NM, -180+deg60NM, deg60NM)},
+		{"unnormalized longitude", 0, 539.9, 60, geoidx.MakeRect(179.9-deg60NM, -deg60NM, 180, deg60NM)},
+		{"pole", 89.9, 100, 60, geoidx.MakeRect(-180, 89.9-deg60NM, 180, 90)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ObjectBox(tt.lat, tt.lng, tt.radiusNM)
+			if !rectEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			if got.SouthWest.Longitude > got.NorthEast.Longitude {
+				t.Fatalf("object box %v crosses the antimeridian", got)
+			}
+		})
+	}
+}
+
+func TestSplitRect(t *testing.T) {
+	tests := []struct {
+		name     string
+		rect     geoidx.Rect
+		expected []geoidx.Rect
+	}{
+		{
+			"regular",
+			geoidx.MakeRect(-10, 35, 30, 60),
+			[]geoidx.Rect{geoidx.MakeRect(-10, 35, 30, 60)},
+		},
+		{
+			"sw longitude greater than ne",
+			geoidx.MakeRect(170, -10, -170, 10),
+			[]geoidx.Rect{geoidx.MakeRect(170, -10, 180, 10), geoidx.MakeRect(-180, -10, -170, 10)},
+		},
+		{
+			"longitude beyond 180",
+			geoidx.MakeRect(170, -10, 190, 10),
+			[]geoidx.Rect{geoidx.MakeRect(170, -10, 180, 10), geoidx.MakeRect(-180, -10, -170, 10)},
+		},
+		{
+			"longitude beyond -180",
+			geoidx.MakeRect(-190, -10, -170, 10),
+			[]geoidx.Rect{geoidx.MakeRect(170, -10, 180, 10), geoidx.MakeRect(-180, -10, -170, 10)},
+		},
+		{
+			"shifted by a full turn",
+			geoidx.MakeRect(350, 0, 370, 10),
+			[]geoidx.Rect{geoidx.MakeRect(-10, 0, 10, 10)},
+		},
+		{
+			"whole world",
+			geoidx.MakeRect(-180, -90, 180, 90),
+			[]geoidx.Rect{geoidx.MakeRect(-180, -90, 180, 90)},
+		},
+		{
+			"wider than the world",
+			geoidx.MakeRect(-200, 80, 200, 95),
+			[]geoidx.Rect{geoidx.MakeRect(-180, 80, 180, 90)},
+		},
+		{
+			"latitudes beyond poles",
+			geoidx.MakeRect(0, -100, 10, 100),
+			[]geoidx.Rect{geoidx.MakeRect(0, -90, 10, 90)},
+		},
+		{
+			"polar cap across antimeridian",
+			geoidx.MakeRect(90, 85, -90, 90),
+			[]geoidx.Rect{geoidx.MakeRect(90, 85, 180, 90), geoidx.MakeRect(-180, 85, -90, 90)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitRect(tt.rect)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if !rectEqual(got[i], tt.expected[i]) {
+					t.Fatalf("expected %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
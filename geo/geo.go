@@ -0,0 +1,130 @@
+// Package geo implements great circle calculations on a spherical earth.
+// Latitudes and longitudes are in degrees, distances are in nautical miles
+// and bearings are true courses in degrees within [0, 360).
+package geo
+
+import "math"
+
+const (
+	EarthRadiusNM = 3440.065
+)
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func toDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// NormalizeLng wraps a longitude into [-180, 180)
+func NormalizeLng(lng float64) float64 {
+	lng = math.Mod(lng+180, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	return lng - 180
+}
+
+// NormalizeBearing wraps a bearing into [0, 360)
+func NormalizeBearing(brg float64) float64 {
+	brg = math.Mod(brg, 360)
+	if brg < 0 {
+		brg += 360
+	}
+	return brg
+}
+
+// DistanceNM is a great circle distance between two points
+func DistanceNM(lat1, lng1, lat2, lng2 float64) float64 {
+	return angularDistance(lat1, lng1, lat2, lng2) * EarthRadiusNM
+}
+
+func angularDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := toRad(lat1)
+	phi2 := toRad(lat2)
+	dPhi := phi2 - phi1
+	dLambda := toRad(lng2 - lng1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Bearing is an initial great circle course from the first point
+// to the second one
+func Bearing(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := toRad(lat1)
+	phi2 := toRad(lat2)
+	dLambda := toRad(lng2 - lng1)
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return NormalizeBearing(toDeg(math.Atan2(y, x)))
+}
+
+// Destination is the point reached by flying the given distance
+// along a great circle starting with the given course
+func Destination(lat, lng, course, distNM float64) (float64, float64) {
+	phi1 := toRad(lat)
+	lambda1 := toRad(lng)
+	theta := toRad(course)
+	delta := distNM / EarthRadiusNM
+
+	sinPhi2 := math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta)
+	phi2 := math.Asin(math.Max(-1, math.Min(1, sinPhi2)))
+	y := math.Sin(theta) * math.Sin(delta) * math.Cos(phi1)
+	x := math.Cos(delta) - math.Sin(phi1)*sinPhi2
+	lambda2 := lambda1 + math.Atan2(y, x)
+	return toDeg(phi2), NormalizeLng(toDeg(lambda2))
+}
+
+// Intermediate returns a point at a given fraction of a great
+// circle route between two points
+func Intermediate(lat1, lng1, lat2, lng2, fraction float64) (float64, float64) {
+	delta := angularDistance(lat1, lng1, lat2, lng2)
+	if delta == 0 {
+		return lat1, lng1
+	}
+
+	phi1, lambda1 := toRad(lat1), toRad(lng1)
+	phi2, lambda2 := toRad(lat2), toRad(lng2)
+
+	a := math.Sin((1-fraction)*delta) / math.Sin(delta)
+	b := math.Sin(fraction*delta) / math.Sin(delta)
+
+	x := a*math.Cos(phi1)*math.Cos(lambda1) + b*math.Cos(phi2)*math.Cos(lambda2)
+	y := a*math.Cos(phi1)*math.Sin(lambda1) + b*math.Cos(phi2)*math.Sin(lambda2)
+	z := a*math.Sin(phi1) + b*math.Sin(phi2)
+
+	phi := math.Atan2(z, math.Sqrt(x*x+y*y))
+	lambda := math.Atan2(y, x)
+	return toDeg(phi), NormalizeLng(toDeg(lambda))
+}
+
+// CrossTrackNM is a signed distance from a point to the great circle
+// going through the start point with the given course, positive to
+// the right of the course
+func CrossTrackNM(startLat, startLng, course, lat, lng float64) float64 {
+	d13 := angularDistance(startLat, startLng, lat, lng)
+	theta13 := toRad(Bearing(startLat, startLng, lat, lng))
+	theta12 := toRad(course)
+	return math.Asin(math.Sin(d13)*math.Sin(theta13-theta12)) * EarthRadiusNM
+}
+
+// AlongTrackNM is a signed distance from the start point to the point
+// closest to the given one on the great circle with the given course,
+// negative if the point is behind the start
+func AlongTrackNM(startLat, startLng, course, lat, lng float64) float64 {
+	d13 := angularDistance(startLat, startLng, lat, lng)
+	theta13 := toRad(Bearing(startLat, startLng, lat, lng))
+	theta12 := toRad(course)
+	dxt := math.Asin(math.Sin(d13) * math.Sin(theta13-theta12))
+
+	ratio := math.Cos(d13) / math.Cos(dxt)
+	dat := math.Acos(math.Max(-1, math.Min(1, ratio))) * EarthRadiusNM
+	if math.Cos(theta13-theta12) < 0 {
+		dat = -dat
+	}
+	return dat
+}
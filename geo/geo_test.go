@@ -0,0 +1,51 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeLng(t *testing.T) {
+	tests := []struct {
+		lng      float64
+		expected float64
+	}{
+		{0, 0},
+		{179.99, 179.99},
+		{180, -180},
+		{-180, -180},
+		{190, -170},
+		{-190, 170},
+		{360, 0},
+		{540, -180},
+		{-539.5, -179.5},
+		{725, 5},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeLng(tt.lng); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("NormalizeLng(%v): expected %v, got %v", tt.lng, tt.expected, got)
+		}
+	}
+}
+
+func TestDistanceAcrossAntimeridian(t *testing.T) {
+	// a degree of longitude at the equator is 60 nm
+	dist := DistanceNM(0, 179.5, 0, -179.5)
+	if math.Abs(dist-60) > 0.1 {
+		t.Fatalf("expected 60 nm, got %v", dist)
+	}
+
+	lat, lng := Intermediate(0, 179.5, 0, -179.5, 0.5)
+	if math.Abs(lat) > 1e-9 || math.Abs(math.Abs(lng)-180) > 1e-9 {
+		t.Fatalf("expected the midpoint on the antimeridian, got %v, %v", lat, lng)
+	}
+}
+
+func TestDestinationOverPole(t *testing.T) {
+	// flying north from 89N 0E for 120 nm ends up at 89N 180E
+	lat, lng := Destination(89, 0, 0, 120)
+	if math.Abs(lat-89) > 0.01 || math.Abs(math.Abs(lng)-180) > 0.01 {
+		t.Fatalf("expected 89, 180, got %v, %v", lat, lng)
+	}
+}
@@ -5,12 +5,22 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
 	"github.com/vatsimnerd/simwatch/provider"
 )
 
+type ApiAirport struct {
+	*merged.Airport
+	ActiveRunways *provider.ActiveRunways `json:"active_runways,omitempty"`
+}
+
 func (s *Server) handleApiAirports(w http.ResponseWriter, r *http.Request) {
 	airports := s.provider.GetAirports()
-	sendPaginated(w, r, airports)
+	apiAirports := make([]*ApiAirport, len(airports))
+	for i, arpt := range airports {
+		apiAirports[i] = s.apiAirport(arpt)
+	}
+	sendPaginated(w, r, apiAirports)
 }
 
 func (s *Server) handleApiAirportsGet(w http.ResponseWriter, r *http.Request) {
@@ -34,5 +44,11 @@ func (s *Server) handleApiAirportsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sendJSON(w, arpt)
+	sendJSON(w, s.apiAirport(arpt))
+}
+
+func (s *Server) apiAirport(arpt *merged.Airport) *ApiAirport {
+	apiArpt := &ApiAirport{Airport: arpt}
+	apiArpt.ActiveRunways, _ = s.provider.GetActiveRunways(arpt.Meta.ICAO)
+	return apiArpt
 }
@@ -0,0 +1,66 @@
+package simwatch
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+func (s *Server) handleApiAirportsBoard(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	icao := vars["id"]
+
+	l := log.WithFields(logrus.Fields{
+		"func": "handleApiAirportsBoard",
+		"icao": icao,
+	})
+
+	board, err := s.provider.GetBoard(icao)
+	if err != nil {
+		if err == provider.ErrNotFound {
+			l.Error("airport not found")
+			sendError(w, 404, "airport not found")
+		} else {
+			l.WithError(err).Error("error building airport board")
+			sendError(w, 500, err.Error())
+		}
+		return
+	}
+
+	sendJSON(w, board)
+}
+
+// forwardBoard sends an airport board to a websocket client after
+// every source data cycle until stop is closed
+func forwardBoard(prov *provider.Provider, icao string, stop <-chan struct{}, mc chan *Message) {
+	l := log.WithFields(logrus.Fields{
+		"func": "forwardBoard",
+		"icao": icao,
+	})
+
+	for {
+		// take the cycle chan before building the board
+		// so no cycle is missed in between
+		next := prov.NextCycle()
+
+		board, err := prov.GetBoard(icao)
+		if err != nil {
+			// the airport may come back with the next static data update
+			l.WithError(err).Debug("error building airport board")
+		} else {
+			select {
+			case mc <- &Message{Type: MessageTypeBoard, Payload: board}:
+			case <-stop:
+				return
+			}
+		}
+
+		select {
+		case <-next:
+		case <-stop:
+			return
+		}
+	}
+}
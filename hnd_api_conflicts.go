@@ -0,0 +1,11 @@
+package simwatch
+
+import (
+	"net/http"
+)
+
+// handleApiConflicts lists active conflicts, clients interested in
+// their start and end subscribe to conflict and conflict_end events
+func (s *Server) handleApiConflicts(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, s.provider.GetConflicts())
+}
@@ -0,0 +1,91 @@
+package simwatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+const (
+	defaultEventsTimeout = 30 * time.Second
+	maxEventsTimeout     = 120 * time.Second
+	recentEventsLimit    = 100
+)
+
+type EventsResponse struct {
+	Seq    uint64           `json:"seq"`
+	Events []provider.Event `json:"events"`
+}
+
+// handleApiEvents returns network events. Without since the latest
+// events are returned immediately, with since the request blocks until
+// newer events appear or timeout (in seconds) expires, i.e.
+// /api/events?since=1234&types=takeoff,landing&timeout=30
+func (s *Server) handleApiEvents(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	types := make([]provider.EventType, 0)
+	if tp := values.Get("types"); tp != "" {
+		for _, t := range strings.Split(tp, ",") {
+			types = append(types, provider.EventType(strings.TrimSpace(t)))
+		}
+	}
+	if err := validateEventTypes(types); err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+
+	sinceValue := values.Get("since")
+	if sinceValue == "" {
+		events, seq := s.provider.RecentEvents(recentEventsLimit, types...)
+		sendJSON(w, EventsResponse{Seq: seq, Events: events})
+		return
+	}
+
+	since, err := strconv.ParseUint(sinceValue, 10, 64)
+	if err != nil {
+		sendError(w, 400, fmt.Sprintf("invalid since: %v", err))
+		return
+	}
+
+	timeout := defaultEventsTimeout
+	if tv := values.Get("timeout"); tv != "" {
+		secs, err := strconv.Atoi(tv)
+		if err != nil || secs < 0 {
+			sendError(w, 400, "invalid timeout")
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+		if timeout > maxEventsTimeout {
+			timeout = maxEventsTimeout
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	events, seq := s.provider.WaitEvents(ctx, since, types...)
+	sendJSON(w, EventsResponse{Seq: seq, Events: events})
+}
+
+// validateEventTypes rejects event types the provider never publishes,
+// subscribing to them would silently yield nothing
+func validateEventTypes(types []provider.EventType) error {
+	for _, t := range types {
+		if !t.IsKnown() {
+			return fmt.Errorf("unknown event type '%s'", t)
+		}
+	}
+	return nil
+}
+
+func forwardEvents(es *provider.EventSubscription, mc chan *Message) {
+	for ev := range es.Events() {
+		mc <- &Message{Type: MessageTypeEvent, Payload: ev}
+	}
+}
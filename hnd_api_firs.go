@@ -0,0 +1,16 @@
+package simwatch
+
+import (
+	"net/http"
+)
+
+// handleApiFIRs lists every known FIR with its staffing and the
+// number of pilots within its boundaries
+func (s *Server) handleApiFIRs(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, s.provider.GetFIRs())
+}
+
+// handleApiFIRsCoverage renders staffed and unstaffed airspace as GeoJSON
+func (s *Server) handleApiFIRsCoverage(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, s.provider.GetFIRCoverage())
+}
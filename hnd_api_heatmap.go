@@ -0,0 +1,150 @@
+package simwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+const (
+	heatmapFormatGrid    = "grid"
+	heatmapFormatGeoJSON = "geojson"
+)
+
+// handleApiHeatmap returns pilot counts per grid cell, e.g.
+// /api/heatmap?sw_lat=35&sw_lng=-10&ne_lat=60&ne_lng=30&res=1&bands=10000,25000&hours=3&format=geojson
+func (s *Server) handleApiHeatmap(w http.ResponseWriter, r *http.Request) {
+	l := log.WithField("func", "handleApiHeatmap")
+
+	values := r.URL.Query()
+	q, err := parseHeatmapQuery(values)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+	format := values.Get("format")
+	if !validHeatmapFormat(format) {
+		sendError(w, 400, fmt.Sprintf("invalid format %s", format))
+		return
+	}
+
+	hm, err := buildHeatmap(r.Context(), s.provider, q)
+	if err != nil {
+		if errors.Is(err, provider.ErrInvalidHeatmap) {
+			sendError(w, 400, err.Error())
+		} else {
+			l.WithError(err).Error("error building heatmap")
+			sendError(w, 500, err.Error())
+		}
+		return
+	}
+
+	sendJSON(w, heatmapPayload(hm, format))
+}
+
+// forwardHeatmap sends a heatmap to a websocket client until stop is
+// closed. Current traffic heatmaps are sent after every data cycle,
+// averaged ones every refresh interval.
+func forwardHeatmap(prov *provider.Provider, req RequestHeatmap, refresh time.Duration, stop <-chan struct{}, mc chan *Message) {
+	l := log.WithFields(logrus.Fields{
+		"func":  "forwardHeatmap",
+		"hours": req.Hours,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for {
+		var nextCycle <-chan struct{}
+		var nextRefresh <-chan time.Time
+		if req.Hours > 0 {
+			nextRefresh = time.After(refresh)
+		} else {
+			nextCycle = prov.NextCycle()
+		}
+
+		hm, err := buildHeatmap(ctx, prov, req.HeatmapQuery)
+		if err != nil {
+			l.WithError(err).Error("error building heatmap")
+		} else {
+			select {
+			case mc <- &Message{Type: MessageTypeHeatmap, Payload: heatmapPayload(hm, req.Format)}:
+			case <-stop:
+				return
+			}
+		}
+
+		select {
+		case <-nextCycle:
+		case <-nextRefresh:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func buildHeatmap(ctx context.Context, prov *provider.Provider, q provider.HeatmapQuery) (*provider.Heatmap, error) {
+	if q.Hours > 0 {
+		return prov.GetHeatmapHistory(ctx, q)
+	}
+	return prov.GetHeatmap(q)
+}
+
+func heatmapPayload(hm *provider.Heatmap, format string) interface{} {
+	if format == heatmapFormatGeoJSON {
+		return hm.GeoJSON()
+	}
+	return hm
+}
+
+func validHeatmapFormat(format string) bool {
+	return format == "" || format == heatmapFormatGrid || format == heatmapFormatGeoJSON
+}
+
+func parseHeatmapQuery(values url.Values) (provider.HeatmapQuery, error) {
+	q := provider.HeatmapQuery{}
+
+	coords := []string{"sw_lat", "sw_lng", "ne_lat", "ne_lng", "res"}
+	parsed := make([]float64, len(coords))
+	for i, name := range coords {
+		v, err := strconv.ParseFloat(values.Get(name), 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s", name)
+		}
+		parsed[i] = v
+	}
+	q.Bounds = geoidx.MakeRect(parsed[1], parsed[0], parsed[3], parsed[2])
+	q.Resolution = parsed[4]
+
+	if bv := values.Get("bands"); bv != "" {
+		for _, b := range strings.Split(bv, ",") {
+			alt, err := strconv.Atoi(strings.TrimSpace(b))
+			if err != nil {
+				return q, fmt.Errorf("invalid bands")
+			}
+			q.AltitudeBands = append(q.AltitudeBands, alt)
+		}
+	}
+
+	if hv := values.Get("hours"); hv != "" {
+		hours, err := strconv.ParseFloat(hv, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid hours")
+		}
+		q.Hours = hours
+	}
+	return q, nil
+}
@@ -7,17 +7,42 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/provider"
 	"github.com/vatsimnerd/simwatch/track"
 )
 
 type ApiPilot struct {
 	*merged.Pilot
-	Track []track.TrackPoint `json:"track"`
+	*provider.Progress
+	Stale bool                 `json:"stale"`
+	Track []track.TrackPoint   `json:"track"`
+	Route *provider.PilotRoute `json:"route,omitempty"`
+}
+
+type ApiPilotSummary struct {
+	*merged.Pilot
+	*provider.Progress
+	Stale bool `json:"stale"`
+}
+
+// ApiFollowedPilot is sent over websocket for pilots followed by id
+type ApiFollowedPilot struct {
+	*ApiPilotSummary
+	Route *provider.PilotRoute `json:"route,omitempty"`
+}
+
+type ApiRadar struct {
+	*merged.Radar
+	Stale bool `json:"stale"`
 }
 
 func (s *Server) handleApiPilots(w http.ResponseWriter, r *http.Request) {
 	pilots := s.provider.GetPilots()
-	sendPaginated(w, r, pilots)
+	summaries := make([]*ApiPilotSummary, len(pilots))
+	for i, pilot := range pilots {
+		summaries[i] = s.pilotSummary(pilot)
+	}
+	sendPaginated(w, r, summaries)
 }
 
 func (s *Server) handleApiPilotsGet(w http.ResponseWriter, r *http.Request) {
@@ -37,7 +62,9 @@ func (s *Server) handleApiPilotsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiPilot := ApiPilot{Pilot: pilot}
+	apiPilot := ApiPilot{Pilot: pilot, Stale: s.provider.IsStale(pilot)}
+	apiPilot.Progress, _ = s.provider.GetProgress(pilot.Callsign)
+	apiPilot.Route, _ = s.provider.GetPilotRoute(pilot.Callsign)
 	tr, err := track.LoadTrack(r.Context(), pilot)
 	if err != nil {
 		l.WithError(err).Error("error loading track")
@@ -48,3 +75,16 @@ func (s *Server) handleApiPilotsGet(w http.ResponseWriter, r *http.Request) {
 	apiPilot.Track = tr.Points
 	sendJSON(w, apiPilot)
 }
+
+// pilotSummary decorates a live pilot with data computed by the provider
+func (s *Server) pilotSummary(pilot *merged.Pilot) *ApiPilotSummary {
+	summary := &ApiPilotSummary{Pilot: pilot, Stale: s.provider.IsStale(pilot)}
+	summary.Progress, _ = s.provider.GetProgress(pilot.Callsign)
+	return summary
+}
+
+func (s *Server) followedPilot(pilot *merged.Pilot) *ApiFollowedPilot {
+	fp := &ApiFollowedPilot{ApiPilotSummary: s.pilotSummary(pilot)}
+	fp.Route, _ = s.provider.GetPilotRoute(pilot.Callsign)
+	return fp
+}
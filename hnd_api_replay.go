@@ -0,0 +1,196 @@
+package simwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+const (
+	replayStateInterval = 1 * time.Second
+)
+
+// handleApiReplay plays stored tracks back over websocket. The time
+// window and initial speed are set by query params, i.e.
+// /api/replay?from=2022-06-01T18:00:00Z&to=2022-06-01T20:00:00Z&speed=10
+// From there on the client may use bounds and pilot_filter requests as
+// with /api/updates and control the playback with pause, resume, seek
+// and speed requests.
+func (s *Server) handleApiReplay(w http.ResponseWriter, r *http.Request) {
+	l := log.WithField("func", "handleApiReplay")
+
+	values := r.URL.Query()
+	from, err := parseTimeParam(values.Get("from"))
+	if err != nil {
+		sendError(w, 400, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	to, err := parseTimeParam(values.Get("to"))
+	if err != nil {
+		sendError(w, 400, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+	speed := 1.0
+	if sp := values.Get("speed"); sp != "" {
+		speed, err = strconv.ParseFloat(sp, 64)
+		if err != nil {
+			sendError(w, 400, fmt.Sprintf("invalid speed: %v", err))
+			return
+		}
+	}
+
+	replay, err := provider.NewReplay(r.Context(), from, to)
+	if err != nil {
+		if err == provider.ErrInvalidWindow {
+			sendError(w, 400, err.Error())
+		} else {
+			l.WithError(err).Error("error loading replay")
+			sendError(w, 500, err.Error())
+		}
+		return
+	}
+	err = replay.SetSpeed(speed)
+	if err != nil {
+		sendError(w, 400, err.Error())
+		return
+	}
+
+	sock, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		l.WithError(err).Error("error upgrading connection")
+		w.WriteHeader(500)
+		return
+	}
+
+	replay.Start()
+	defer replay.Stop()
+
+	sub := replay.Subscribe(1024)
+	defer replay.Unsubscribe(sub)
+
+	mc := make(chan *Message, 1024)
+	go sendMessages(sock, sub, mc, replayObjectWrapper)
+	defer close(mc)
+
+	// periodically report the replay clock so clients can display it
+	var wg sync.WaitGroup
+	stateDone := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sendReplayStates(replay, mc, stateDone)
+	}()
+	defer wg.Wait()
+	defer close(stateDone)
+
+	for {
+		_, buf, err := sock.ReadMessage()
+		l.WithField("buf", string(buf)).WithError(err).Trace("message from client")
+		if err != nil {
+			l.WithError(err).Error("error reading message")
+			break
+		}
+
+		req := &Request{}
+		err = json.Unmarshal(buf, req)
+
+		if err != nil {
+			l.WithError(err).Error("error parsing request")
+			continue
+		}
+
+		switch req.Type {
+		case RequestTypeBounds:
+			err = json.Unmarshal(req.Payload, &req.Bounds)
+		case RequestTypePilotsFilter:
+			err = json.Unmarshal(req.Payload, &req.PilotFilter)
+		case RequestTypeSeek:
+			err = json.Unmarshal(req.Payload, &req.Seek)
+		case RequestTypeSpeed:
+			err = json.Unmarshal(req.Payload, &req.Speed)
+		}
+
+		if err != nil {
+			l.WithError(err).WithField("req_type", req.Type).Error("error parsing request payload")
+			sendErrorMessage(mc, req.ID, err)
+			continue
+		}
+
+		log.WithField("req", req).Debug("replay request received")
+
+		switch req.Type {
+		case RequestTypeBounds:
+			if err := provider.ValidateBounds(req.Bounds); err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			sub.SetBounds(req.Bounds...)
+			sendStatusMessage(mc, req.ID, "bounds set")
+		case RequestTypePilotsFilter:
+			err = sub.SetPilotFilter(req.PilotFilter.Query)
+			if err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			sendStatusMessage(mc, req.ID, "pilot filter set")
+		case RequestTypePause:
+			replay.Pause()
+			sendStatusMessage(mc, req.ID, "replay paused")
+		case RequestTypeResume:
+			replay.Resume()
+			sendStatusMessage(mc, req.ID, "replay resumed")
+		case RequestTypeSeek:
+			replay.Seek(time.Unix(req.Seek.TimeStamp, 0))
+			sendStatusMessage(mc, req.ID, "replay clock set")
+		case RequestTypeSpeed:
+			err = replay.SetSpeed(req.Speed.Speed)
+			if err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			sendStatusMessage(mc, req.ID, "replay speed set")
+		default:
+			sendErrorMessage(mc, req.ID, fmt.Errorf("request type %s is not supported in replay", req.Type))
+		}
+	}
+}
+
+// replayObjectWrapper gives replayed pilots the shape live updates
+// have, progress and staleness don't apply to past positions
+func replayObjectWrapper(obj interface{}) interface{} {
+	if pilot, ok := obj.(*merged.Pilot); ok {
+		return &ApiPilotSummary{Pilot: pilot}
+	}
+	return obj
+}
+
+func sendReplayStates(replay *provider.Replay, mc chan *Message, done <-chan struct{}) {
+	t := time.NewTicker(replayStateInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			mc <- &Message{Type: MessageTypeReplay, Payload: replay.State()}
+		case <-done:
+			return
+		}
+	}
+}
+
+// parseTimeParam accepts either unix timestamps or RFC3339 dates
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("value is missing")
+	}
+	if ux, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ux, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
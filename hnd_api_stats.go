@@ -0,0 +1,54 @@
+package simwatch
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/stats"
+)
+
+type StatsResponse struct {
+	Resolution stats.Resolution `json:"resolution"`
+	Points     []stats.Point    `json:"points"`
+}
+
+// handleApiStats returns a statistics series, e.g. /api/stats?res=1h&from=2022-05-01T00:00:00Z
+// res defaults to 1m, from and to default to the whole retention period
+func (s *Server) handleApiStats(w http.ResponseWriter, r *http.Request) {
+	if s.stats == nil {
+		sendError(w, 404, "stats are disabled")
+		return
+	}
+
+	values := r.URL.Query()
+	res := stats.ResolutionMinute
+	if rv := values.Get("res"); rv != "" {
+		res = stats.Resolution(rv)
+	}
+
+	var err error
+	from := time.Time{}
+	if fv := values.Get("from"); fv != "" {
+		from, err = parseTimeParam(fv)
+		if err != nil {
+			sendError(w, 400, fmt.Sprintf("invalid from: %v", err))
+			return
+		}
+	}
+	to := time.Now()
+	if tv := values.Get("to"); tv != "" {
+		to, err = parseTimeParam(tv)
+		if err != nil {
+			sendError(w, 400, fmt.Sprintf("invalid to: %v", err))
+			return
+		}
+	}
+
+	points, err := s.stats.Series(res, from, to)
+	if err != nil {
+		sendError(w, 400, fmt.Sprintf("%v %s", err, res))
+		return
+	}
+	sendJSON(w, StatsResponse{Resolution: res, Points: points})
+}
@@ -0,0 +1,36 @@
+package simwatch
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+func (s *Server) handleApiStatus(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, s.provider.Status())
+}
+
+// forwardStatus sends data freshness status to a websocket client
+// right away and then every interval until stop is closed
+func forwardStatus(prov *provider.Provider, interval time.Duration, stop <-chan struct{}, mc chan *Message) {
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case mc <- &Message{Type: MessageTypeDataStatus, Payload: prov.Status()}:
+		case <-stop:
+			return
+		}
+
+		select {
+		case <-t.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -2,7 +2,9 @@ package simwatch
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -10,6 +12,7 @@ import (
 	"github.com/vatsimnerd/geoidx"
 	"github.com/vatsimnerd/simwatch-providers/merged"
 	"github.com/vatsimnerd/simwatch/provider"
+	"github.com/vatsimnerd/util/set"
 )
 
 const (
@@ -44,9 +47,53 @@ func (s *Server) handleApiUpdates(w http.ResponseWriter, r *http.Request) {
 	//
 	// also websocket doesn't allow concurrent writing so this
 	// goroutine must be the only one writing to a ws connection
-	go sendMessages(sock, sub, mc)
+	// pilots followed by id get their routes along with updates
+	followed := set.NewSafe[string]()
+	wrap := func(obj interface{}) interface{} {
+		if pilot, ok := obj.(*merged.Pilot); ok && followed.Has(pilot.Callsign) {
+			return s.followedPilot(pilot)
+		}
+		return s.liveObjectWrapper(obj)
+	}
+	go sendMessages(sock, sub, mc, wrap)
 	defer close(mc)
 
+	// network events are opt-in and forwarded by a separate goroutine
+	var events *provider.EventSubscription
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer func() {
+		if events != nil {
+			s.provider.UnsubscribeEvents(events)
+		}
+	}()
+
+	statusStop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		forwardStatus(s.provider, s.statusInterval, statusStop, mc)
+	}()
+	defer close(statusStop)
+
+	// airport boards are pushed after every data cycle, each
+	// board has its own forwarder stopped by closing its chan
+	boards := make(map[string]chan struct{})
+	defer func() {
+		for _, stop := range boards {
+			close(stop)
+		}
+	}()
+
+	// a single heatmap stream per connection, a new
+	// subscription replaces the previous one
+	var heatmapStop chan struct{}
+	defer func() {
+		if heatmapStop != nil {
+			close(heatmapStop)
+		}
+	}()
+
 	for {
 		_, buf, err := sock.ReadMessage()
 		l.WithField("buf", string(buf)).WithError(err).Trace("message from client")
@@ -74,6 +121,16 @@ func (s *Server) handleApiUpdates(w http.ResponseWriter, r *http.Request) {
 			fallthrough
 		case RequestTypeUnsubscribeID:
 			err = json.Unmarshal(req.Payload, &req.SubID)
+		case RequestTypeSubscribeEvents:
+			if len(req.Payload) > 0 {
+				err = json.Unmarshal(req.Payload, &req.Events)
+			}
+		case RequestTypeSubscribeBoard:
+			fallthrough
+		case RequestTypeUnsubscribeBoard:
+			err = json.Unmarshal(req.Payload, &req.Board)
+		case RequestTypeSubscribeHeatmap:
+			err = json.Unmarshal(req.Payload, &req.Heatmap)
 		}
 
 		if err != nil {
@@ -86,20 +143,104 @@ func (s *Server) handleApiUpdates(w http.ResponseWriter, r *http.Request) {
 
 		switch req.Type {
 		case RequestTypeBounds:
-			bounds := req.Bounds
-			sub.SetBounds(bounds)
+			if err := provider.ValidateBounds(req.Bounds); err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			sub.SetBounds(req.Bounds...)
 			sendStatusMessage(mc, req.ID, "bounds set")
+		case RequestTypeSubscribeID:
+			// marked first as tracking emits the object right away
+			followed.Add(req.SubID.ID)
+			sub.TrackID(req.SubID.ID)
+			sendStatusMessage(mc, req.ID, "subscribed to id")
+		case RequestTypeUnsubscribeID:
+			sub.UntrackID(req.SubID.ID)
+			followed.Delete(req.SubID.ID)
+			sendStatusMessage(mc, req.ID, "unsubscribed from id")
 		case RequestTypeAirportsFilter:
 			sub.SetAirportFilter(req.AirportFilter.IncludeUncontrolled)
 			sendStatusMessage(mc, req.ID, "airport filter set")
 		case RequestTypePilotsFilter:
 			sub.SetPilotFilter(req.PilotFilter.Query)
 			sendStatusMessage(mc, req.ID, "pilot filter set")
+		case RequestTypeSubscribeEvents:
+			if err := validateEventTypes(req.Events.Types); err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			if events != nil {
+				// the forwarder quits as soon as the channel is closed
+				s.provider.UnsubscribeEvents(events)
+			}
+			events = s.provider.SubscribeEvents(1024, req.Events.Types...)
+			wg.Add(1)
+			go func(es *provider.EventSubscription) {
+				defer wg.Done()
+				forwardEvents(es, mc)
+			}(events)
+			sendStatusMessage(mc, req.ID, "subscribed to events")
+		case RequestTypeUnsubscribeEvents:
+			if events != nil {
+				s.provider.UnsubscribeEvents(events)
+				events = nil
+			}
+			sendStatusMessage(mc, req.ID, "unsubscribed from events")
+		case RequestTypeSubscribeBoard:
+			icao := req.Board.ICAO
+			if _, err := s.provider.GetAirportByICAO(icao); err != nil {
+				sendErrorMessage(mc, req.ID, fmt.Errorf("airport %s not found", icao))
+				continue
+			}
+			if stop, found := boards[icao]; found {
+				close(stop)
+			}
+			stop := make(chan struct{})
+			boards[icao] = stop
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				forwardBoard(s.provider, icao, stop, mc)
+			}()
+			sendStatusMessage(mc, req.ID, "subscribed to board")
+		case RequestTypeUnsubscribeBoard:
+			if stop, found := boards[req.Board.ICAO]; found {
+				close(stop)
+				delete(boards, req.Board.ICAO)
+			}
+			sendStatusMessage(mc, req.ID, "unsubscribed from board")
+		case RequestTypeSubscribeHeatmap:
+			if !validHeatmapFormat(req.Heatmap.Format) {
+				sendErrorMessage(mc, req.ID, fmt.Errorf("invalid format %s", req.Heatmap.Format))
+				continue
+			}
+			if err := s.provider.ValidateHeatmapQuery(req.Heatmap.HeatmapQuery); err != nil {
+				sendErrorMessage(mc, req.ID, err)
+				continue
+			}
+			if heatmapStop != nil {
+				close(heatmapStop)
+			}
+			heatmapStop = make(chan struct{})
+			wg.Add(1)
+			go func(hreq RequestHeatmap, stop chan struct{}) {
+				defer wg.Done()
+				forwardHeatmap(s.provider, hreq, s.heatmapRefresh, stop, mc)
+			}(req.Heatmap, heatmapStop)
+			sendStatusMessage(mc, req.ID, "subscribed to heatmap")
+		case RequestTypeUnsubscribeHeatmap:
+			if heatmapStop != nil {
+				close(heatmapStop)
+				heatmapStop = nil
+			}
+			sendStatusMessage(mc, req.ID, "unsubscribed from heatmap")
 		}
 	}
 }
 
-func sendMessages(sock *websocket.Conn, sub *provider.Subscription, mc <-chan *Message) {
+// sendMessages writes subscription events and messages to a websocket,
+// wrap, if set, replaces objects of set events before sending
+func sendMessages(sock *websocket.Conn, sub *provider.Subscription, mc <-chan *Message, wrap func(interface{}) interface{}) {
 	l := log.WithFields(logrus.Fields{
 		"func":   "sendMessages",
 		"sub_id": sub.ID(),
@@ -161,7 +302,11 @@ func sendMessages(sock *websocket.Conn, sub *provider.Subscription, mc <-chan *M
 				acc = makeObjectUpdate(eType, oType, maxObjectsPerUpdate)
 			}
 
-			if acc.add(event.Obj.Value()) {
+			obj := event.Obj.Value()
+			if wrap != nil && eType == "set" {
+				obj = wrap(obj)
+			}
+			if acc.add(obj) {
 				l.WithField("obj_count", len(acc.Objects)).Debug("acc is full, flushing")
 				// if acc is full, send its contents and reset
 				sock.WriteJSON(acc.message())
@@ -183,6 +328,20 @@ func sendMessages(sock *websocket.Conn, sub *provider.Subscription, mc <-chan *M
 	}
 }
 
+// liveObjectWrapper decorates live objects with staleness, progress
+// and active runways for websocket clients
+func (s *Server) liveObjectWrapper(obj interface{}) interface{} {
+	switch o := obj.(type) {
+	case *merged.Pilot:
+		return s.pilotSummary(o)
+	case *merged.Radar:
+		return &ApiRadar{Radar: o, Stale: s.provider.IsStale(o)}
+	case *merged.Airport:
+		return s.apiAirport(o)
+	}
+	return obj
+}
+
 func sendErrorMessage(mc chan *Message, reqID string, err error) {
 	msg := &Message{
 		Type: MessageTypeError,
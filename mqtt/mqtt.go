@@ -0,0 +1,222 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+const (
+	subChSize = 32768
+	// publishes awaiting broker acknowledgement, the loop
+	// blocks only when that many are still in flight
+	maxInFlight = 1024
+)
+
+var (
+	log = logrus.WithField("module", "mqtt")
+
+	// topic levels can't contain separators and wildcards
+	topicSanitizer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+)
+
+// Publisher mirrors provider objects onto retained MQTT topics,
+// i.e. simwatch/pilot/AFL123. Deleted objects get an empty retained
+// message which clears the topic on the broker.
+type Publisher struct {
+	cfg    config.MQTTConfig
+	client paho.Client
+	sub    *provider.Subscription
+
+	// airports published so far, used to clear the ones
+	// becoming uncontrolled
+	airports map[string]bool
+
+	inFlight  chan pendingPublish
+	published uint64
+	failed    uint64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type pendingPublish struct {
+	topic string
+	token paho.Token
+}
+
+type PublisherStats struct {
+	Published uint64 `json:"published"`
+	Failed    uint64 `json:"failed"`
+	InFlight  int    `json:"in_flight"`
+}
+
+func New(cfg config.MQTTConfig) *Publisher {
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(cfg.Timeout).
+		SetWriteTimeout(cfg.Timeout)
+
+	return &Publisher{
+		cfg:      cfg,
+		client:   paho.NewClient(opts),
+		airports: make(map[string]bool),
+		inFlight: make(chan pendingPublish, maxInFlight),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start connects to the broker and subscribes to the whole world
+func (p *Publisher) Start(prov *provider.Provider) error {
+	l := log.WithFields(logrus.Fields{
+		"func":   "Start",
+		"broker": p.cfg.Broker,
+	})
+
+	l.Info("connecting to mqtt broker")
+	token := p.client.Connect()
+	if !token.WaitTimeout(p.cfg.Timeout) {
+		return fmt.Errorf("timeout connecting to mqtt broker %s", p.cfg.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("error connecting to mqtt broker %s: %w", p.cfg.Broker, err)
+	}
+
+	p.sub = prov.Subscribe(subChSize)
+	p.wg.Add(2)
+	go p.loop(prov)
+	go p.confirm()
+
+	p.sub.SetBounds(geoidx.MakeRect(-180, -90, 180, 90))
+	return nil
+}
+
+func (p *Publisher) Stop() {
+	if p.sub == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.client.Disconnect(250)
+}
+
+// Stats reports publish outcomes, failures include timeouts
+func (p *Publisher) Stats() PublisherStats {
+	return PublisherStats{
+		Published: atomic.LoadUint64(&p.published),
+		Failed:    atomic.LoadUint64(&p.failed),
+		InFlight:  len(p.inFlight),
+	}
+}
+
+func (p *Publisher) loop(prov *provider.Provider) {
+	defer p.wg.Done()
+	defer prov.Unsubscribe(p.sub)
+	// no more publishes, confirm drains the rest and exits
+	defer close(p.inFlight)
+
+	for {
+		select {
+		case event, ok := <-p.sub.Events():
+			if !ok {
+				return
+			}
+			p.handle(event)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *Publisher) handle(event geoidx.Event) {
+	var topic string
+	var obj interface{}
+
+	deleted := event.Type == geoidx.EventTypeDelete
+
+	switch o := event.Obj.Value().(type) {
+	case *merged.Pilot:
+		topic = p.topic("pilot", o.Callsign)
+		obj = o
+	case *merged.Radar:
+		topic = p.topic("radar", o.Controller.Callsign)
+		obj = o
+	case *merged.Airport:
+		topic = p.topic("airport", o.Meta.ICAO)
+		obj = o
+		if !deleted && !p.cfg.IncludeUncontrolled && !o.IsControlled() {
+			if !p.airports[o.Meta.ICAO] {
+				// never published, nothing to clear
+				return
+			}
+			deleted = true
+		}
+		if deleted {
+			delete(p.airports, o.Meta.ICAO)
+		} else {
+			p.airports[o.Meta.ICAO] = true
+		}
+	default:
+		return
+	}
+
+	if deleted {
+		p.publish(topic, nil)
+		return
+	}
+
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		log.WithError(err).WithField("topic", topic).Error("error encoding object")
+		return
+	}
+	p.publish(topic, payload)
+}
+
+// publish hands the message over to the client without waiting
+// for the broker, outcomes are collected by confirm
+func (p *Publisher) publish(topic string, payload []byte) {
+	token := p.client.Publish(topic, p.cfg.QoS, true, payload)
+	p.inFlight <- pendingPublish{topic: topic, token: token}
+}
+
+// confirm waits for publishes in order counting failures
+func (p *Publisher) confirm() {
+	defer p.wg.Done()
+
+	for pp := range p.inFlight {
+		l := log.WithFields(logrus.Fields{
+			"func":  "confirm",
+			"topic": pp.topic,
+		})
+
+		if !pp.token.WaitTimeout(p.cfg.Timeout) {
+			atomic.AddUint64(&p.failed, 1)
+			l.Error("timeout publishing message")
+			continue
+		}
+		if err := pp.token.Error(); err != nil {
+			atomic.AddUint64(&p.failed, 1)
+			l.WithError(err).Error("error publishing message")
+			continue
+		}
+		atomic.AddUint64(&p.published, 1)
+	}
+}
+
+func (p *Publisher) topic(otype string, id string) string {
+	return fmt.Sprintf("%s/%s/%s", p.cfg.Prefix, otype, topicSanitizer.Replace(id))
+}
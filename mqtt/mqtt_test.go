@@ -0,0 +1,193 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/simwatch/config"
+)
+
+// broker is a minimal local MQTT broker recording publishes
+type broker struct {
+	ln       net.Listener
+	ack      bool
+	messages []*packets.PublishPacket
+	received chan struct{}
+	lock     sync.Mutex
+}
+
+func newBroker(t *testing.T, ack bool) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln, ack: ack, received: make(chan struct{}, 100)}
+	go b.serve()
+	return b
+}
+
+func (b *broker) addr() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		cp, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch pkt := cp.(type) {
+		case *packets.ConnectPacket:
+			reply = packets.NewControlPacket(packets.Connack)
+		case *packets.PublishPacket:
+			b.lock.Lock()
+			b.messages = append(b.messages, pkt)
+			b.lock.Unlock()
+			b.received <- struct{}{}
+			if pkt.Qos == 1 && b.ack {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = pkt.MessageID
+				reply = ack
+			}
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+		if reply != nil {
+			if err := reply.Write(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *broker) wait(t *testing.T, count int) []*packets.PublishPacket {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-b.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d messages, got %d", count, i)
+		}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]*packets.PublishPacket{}, b.messages...)
+}
+
+// connect starts the publisher without a provider, events
+// are fed to handle directly
+func connect(t *testing.T, b *broker, timeout time.Duration) *Publisher {
+	t.Helper()
+	p := New(config.MQTTConfig{
+		Broker:   b.addr(),
+		ClientID: "simwatch-test",
+		Prefix:   "simwatch",
+		QoS:      1,
+		Timeout:  timeout,
+	})
+	token := p.client.Connect()
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("error connecting to the broker: %v", token.Error())
+	}
+	p.wg.Add(1)
+	go p.confirm()
+	return p
+}
+
+// finish waits for every publish to be confirmed
+func finish(p *Publisher) {
+	close(p.inFlight)
+	p.wg.Wait()
+	p.client.Disconnect(250)
+}
+
+func setEvent(id string, value interface{}) geoidx.Event {
+	return geoidx.Event{Type: geoidx.EventTypeSet, Obj: geoidx.NewObject(id, geoidx.MakeRect(0, 0, 0, 0), value)}
+}
+
+func deleteEvent(id string, value interface{}) geoidx.Event {
+	return geoidx.Event{Type: geoidx.EventTypeDelete, Obj: geoidx.NewObject(id, geoidx.MakeRect(0, 0, 0, 0), value)}
+}
+
+func TestPublish(t *testing.T) {
+	b := newBroker(t, true)
+	defer b.ln.Close()
+	p := connect(t, b, 5*time.Second)
+
+	pilot := &merged.Pilot{Pilot: vatsimapi.Pilot{Callsign: "AFL/123", Latitude: 55.5}}
+	uncontrolled := &merged.Airport{Meta: vatspydata.AirportMeta{ICAO: "UUEE"}}
+	radar := &merged.Radar{Controller: vatsimapi.Controller{Callsign: "EGTT_CTR"}}
+
+	p.handle(setEvent("AFL/123", pilot))
+	// never published so there is nothing to clear
+	p.handle(setEvent("UUEE", uncontrolled))
+	p.handle(deleteEvent("EGTT_CTR", radar))
+
+	msgs := b.wait(t, 2)
+	finish(p)
+
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if msgs[0].TopicName != "simwatch/pilot/AFL_123" || !msgs[0].Retain {
+		t.Fatalf("unexpected pilot message %v", msgs[0])
+	}
+	var got merged.Pilot
+	if err := json.Unmarshal(msgs[0].Payload, &got); err != nil || got.Latitude != 55.5 {
+		t.Fatalf("unexpected pilot payload %s", msgs[0].Payload)
+	}
+	if msgs[1].TopicName != "simwatch/radar/EGTT_CTR" || !msgs[1].Retain || len(msgs[1].Payload) != 0 {
+		t.Fatalf("deleted radar must clear its topic, got %v", msgs[1])
+	}
+
+	stats := p.Stats()
+	if stats.Published != 2 || stats.Failed != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPublishFailures(t *testing.T) {
+	// the broker never acknowledges QoS 1 messages
+	b := newBroker(t, false)
+	defer b.ln.Close()
+	p := connect(t, b, 100*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		p.handle(setEvent("AAA1", &merged.Pilot{Pilot: vatsimapi.Pilot{Callsign: "AAA1"}}))
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("publishing blocked for %v", elapsed)
+	}
+
+	b.wait(t, 3)
+	finish(p)
+
+	stats := p.Stats()
+	if stats.Published != 0 || stats.Failed != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,177 @@
+package provider
+
+import (
+	"sort"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+type FlightStatus string
+
+// Flight statuses shown on airport boards. VATSIM prefiles aren't
+// part of merged data so prefiled stands for a connected pilot with
+// a flight plan who hasn't started moving yet.
+const (
+	FlightPrefiled FlightStatus = "prefiled"
+	FlightTaxiing  FlightStatus = "taxiing"
+	FlightDeparted FlightStatus = "departed"
+	FlightEnRoute  FlightStatus = "enroute"
+	FlightApproach FlightStatus = "approach"
+	FlightLanded   FlightStatus = "landed"
+
+	taxiMinSpeed     = 5
+	departedRadiusNM = 40
+	approachRadiusNM = 40
+	landedRadiusNM   = 10
+)
+
+var (
+	// arrivals show flights closest to landing first,
+	// departures the ones about to leave
+	arrivalOrder = map[FlightStatus]int{
+		FlightLanded:   0,
+		FlightApproach: 1,
+		FlightEnRoute:  2,
+		FlightDeparted: 3,
+		FlightTaxiing:  4,
+		FlightPrefiled: 5,
+	}
+	departureOrder = map[FlightStatus]int{
+		FlightTaxiing:  0,
+		FlightPrefiled: 1,
+		FlightDeparted: 2,
+		FlightEnRoute:  3,
+		FlightApproach: 4,
+		FlightLanded:   5,
+	}
+)
+
+type (
+	// BoardEntry is a single flight on an airport board, DistanceToGo
+	// and ETA are missing if the arrival airport is unknown
+	BoardEntry struct {
+		Callsign     string       `json:"callsign"`
+		Aircraft     string       `json:"aircraft"`
+		Departure    string       `json:"departure"`
+		Arrival      string       `json:"arrival"`
+		Status       FlightStatus `json:"status"`
+		Altitude     int          `json:"altitude"`
+		Groundspeed  int          `json:"groundspeed"`
+		DistanceToGo *float64     `json:"dtg,omitempty"`
+		ETA          *time.Time   `json:"eta,omitempty"`
+	}
+
+	// Board lists flights departing from and arriving to an airport
+	Board struct {
+		ICAO       string       `json:"icao"`
+		Time       time.Time    `json:"ts"`
+		Departures []BoardEntry `json:"departures"`
+		Arrivals   []BoardEntry `json:"arrivals"`
+	}
+)
+
+// GetBoard builds an arrival/departure board from flight plans
+// of connected pilots
+func (p *Provider) GetBoard(icao string) (*Board, error) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+
+	if _, found := p.airports[icao]; !found {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now()
+	board := &Board{
+		ICAO:       icao,
+		Time:       now,
+		Departures: make([]BoardEntry, 0),
+		Arrivals:   make([]BoardEntry, 0),
+	}
+
+	for _, pilot := range p.pilots {
+		fp := pilot.FlightPlan
+		if fp == nil || (fp.Departure != icao && fp.Arrival != icao) {
+			continue
+		}
+		entry := p.boardEntryUnsafe(pilot)
+		if fp.Departure == icao {
+			board.Departures = append(board.Departures, entry)
+		}
+		if fp.Arrival == icao {
+			board.Arrivals = append(board.Arrivals, entry)
+		}
+	}
+
+	sort.Slice(board.Departures, func(i, j int) bool {
+		return boardLess(&board.Departures[i], &board.Departures[j], departureOrder)
+	})
+	sort.Slice(board.Arrivals, func(i, j int) bool {
+		return boardLess(&board.Arrivals[i], &board.Arrivals[j], arrivalOrder)
+	})
+	return board, nil
+}
+
+// boardEntryUnsafe must be called with dataLock held
+func (p *Provider) boardEntryUnsafe(pilot *merged.Pilot) BoardEntry {
+	fp := pilot.FlightPlan
+	entry := BoardEntry{
+		Callsign:    pilot.Callsign,
+		Aircraft:    fp.Aircraft,
+		Departure:   fp.Departure,
+		Arrival:     fp.Arrival,
+		Altitude:    pilot.Altitude,
+		Groundspeed: pilot.Groundspeed,
+	}
+
+	dep := p.airports[fp.Departure]
+	arr := p.airports[fp.Arrival]
+	entry.Status = flightStatus(pilot, dep, arr, p.airborne[pilot.Callsign])
+
+	if prog, found := p.progressUnsafe(pilot.Callsign); found {
+		dtg := prog.DistanceToGo
+		entry.DistanceToGo = &dtg
+		if entry.Status != FlightLanded {
+			entry.ETA = prog.ETA
+		}
+	}
+	return entry
+}
+
+// flightStatus guesses the status by the pilot's position. A pilot on
+// the ground at the arrival airport has landed only if it has been
+// airborne or the departure airport is elsewhere.
+func flightStatus(pilot *merged.Pilot, dep *merged.Airport, arr *merged.Airport, airborne bool) FlightStatus {
+	if track.IsOnGround(pilot) {
+		atDeparture := dep != nil && distanceToAirport(pilot, dep) <= landedRadiusNM
+		if arr != nil && distanceToAirport(pilot, arr) <= landedRadiusNM && (airborne || !atDeparture) {
+			return FlightLanded
+		}
+		if pilot.Groundspeed >= taxiMinSpeed {
+			return FlightTaxiing
+		}
+		return FlightPrefiled
+	}
+
+	if arr != nil && distanceToAirport(pilot, arr) <= approachRadiusNM {
+		return FlightApproach
+	}
+	if dep != nil && distanceToAirport(pilot, dep) <= departedRadiusNM {
+		return FlightDeparted
+	}
+	return FlightEnRoute
+}
+
+func boardLess(a *BoardEntry, b *BoardEntry, order map[FlightStatus]int) bool {
+	if order[a.Status] != order[b.Status] {
+		return order[a.Status] < order[b.Status]
+	}
+	if a.ETA != nil && b.ETA != nil && !a.ETA.Equal(*b.ETA) {
+		return a.ETA.Before(*b.ETA)
+	}
+	if (a.ETA == nil) != (b.ETA == nil) {
+		return a.ETA != nil
+	}
+	return a.Callsign < b.Callsign
+}
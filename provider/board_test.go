@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+)
+
+func testAirport(icao string, lat, lng float64) *merged.Airport {
+	return &merged.Airport{Meta: vatspydata.AirportMeta{
+		ICAO:     icao,
+		Position: vatspydata.Point{Lat: lat, Lng: lng},
+	}}
+}
+
+func TestFlightStatus(t *testing.T) {
+	egll := testAirport("EGLL", 51.47, -0.46)
+	lfpg := testAirport("LFPG", 49.01, 2.55)
+
+	tcs := []struct {
+		name     string
+		lat, lng float64
+		gs       int
+		dep, arr *merged.Airport
+		airborne bool
+		expected FlightStatus
+	}{
+		{"parked", 51.47, -0.46, 0, egll, lfpg, false, FlightPrefiled},
+		{"taxiing", 51.47, -0.46, 15, egll, lfpg, false, FlightTaxiing},
+		{"departed", 51.6, -0.2, 250, egll, lfpg, true, FlightDeparted},
+		{"enroute", 50.5, 1.0, 450, egll, lfpg, true, FlightEnRoute},
+		{"approach", 49.2, 2.4, 250, egll, lfpg, true, FlightApproach},
+		{"landed", 49.01, 2.55, 20, egll, lfpg, true, FlightLanded},
+		// airborne state is unknown without a stored track
+		{"landed restored", 49.01, 2.55, 0, egll, lfpg, false, FlightLanded},
+		{"local flight parked", 51.47, -0.46, 0, egll, egll, false, FlightPrefiled},
+		{"local flight taxiing", 51.47, -0.46, 15, egll, egll, false, FlightTaxiing},
+		{"local flight landed", 51.47, -0.46, 15, egll, egll, true, FlightLanded},
+		{"unknown arrival", 49.01, 2.55, 0, egll, nil, true, FlightPrefiled},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pilot := testPilot("AAA1", tc.lat, tc.lng)
+			pilot.Groundspeed = tc.gs
+			status := flightStatus(&pilot, tc.dep, tc.arr, tc.airborne)
+			if status != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+)
+
+const (
+	maxBoundsRects = 16
+)
+
+var (
+	ErrInvalidBounds = fmt.Errorf("invalid bounds")
+)
+
+// ValidateBounds checks subscription bounds. Longitudes may go beyond
+// ±180 as map libraries report them for views panned over the antimeridian,
+// SW longitude greater than NE one is a rect crossing the antimeridian too.
+func ValidateBounds(bounds []geoidx.Rect) error {
+	if len(bounds) == 0 {
+		return fmt.Errorf("%w: no rects given", ErrInvalidBounds)
+	}
+	if len(bounds) > maxBoundsRects {
+		return fmt.Errorf("%w: more than %d rects given", ErrInvalidBounds, maxBoundsRects)
+	}
+	for _, rect := range bounds {
+		sw, ne := rect.SouthWest, rect.NorthEast
+		if sw.Latitude > ne.Latitude {
+			return fmt.Errorf("%w: south latitude is greater than north one", ErrInvalidBounds)
+		}
+		for _, v := range []float64{sw.Latitude, sw.Longitude, ne.Latitude, ne.Longitude} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w: coordinates must be finite", ErrInvalidBounds)
+			}
+		}
+	}
+	return nil
+}
+
+// indexBounds is a single rect for the index subscription covering all
+// the rects, objects in between are dropped by the bounds filter. Rects
+// are expected to be split at the antimeridian already, the envelope is
+// the smallest one on the longitude circle and crosses the antimeridian
+// if that's shorter, the index splits such a rect itself.
+func indexBounds(rects []geoidx.Rect) geoidx.Rect {
+	spans := make([][2]float64, len(rects))
+	minLat, maxLat := rects[0].SouthWest.Latitude, rects[0].NorthEast.Latitude
+	for i, rect := range rects {
+		spans[i] = [2]float64{rect.SouthWest.Longitude, rect.NorthEast.Longitude}
+		minLat = math.Min(minLat, rect.SouthWest.Latitude)
+		maxLat = math.Max(maxLat, rect.NorthEast.Latitude)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	// the envelope leaves out the widest longitude gap between the
+	// rects, the one through the antimeridian goes first
+	west, east := spans[0][0], spans[0][1]
+	for _, span := range spans[1:] {
+		east = math.Max(east, span[1])
+	}
+	widestGap := spans[0][0] + 360 - east
+
+	reach := spans[0][1]
+	for _, span := range spans[1:] {
+		if gap := span[0] - reach; gap > widestGap {
+			widestGap = gap
+			west, east = span[0], reach
+		}
+		reach = math.Max(reach, span[1])
+	}
+
+	return geoidx.MakeRect(west, minLat, east, maxLat)
+}
+
+// boundsFilter passes objects intersecting any of the rects, radars are
+// checked against FIR polygons if intersects is set
+func boundsFilter(rects []geoidx.Rect, intersects func(*merged.Radar, geoidx.Rect) bool) geoidx.Filter {
+	return func(obj *geoidx.Object) bool {
+		if radar, ok := obj.Value().(*merged.Radar); ok && intersects != nil {
+			for _, rect := range rects {
+				if intersects(radar, rect) {
+					return true
+				}
+			}
+			return false
+		}
+
+		ob := obj.Bounds()
+		minLng, minLat := ob.PointCoord(0), ob.PointCoord(1)
+		maxLng, maxLat := minLng+ob.LengthsCoord(0), minLat+ob.LengthsCoord(1)
+		for _, rect := range rects {
+			if minLng <= rect.NorthEast.Longitude && maxLng >= rect.SouthWest.Longitude &&
+				minLat <= rect.NorthEast.Latitude && maxLat >= rect.SouthWest.Latitude {
+				return true
+			}
+		}
+		return false
+	}
+}
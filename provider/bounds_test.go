@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+func TestIndexBounds(t *testing.T) {
+	tcs := []struct {
+		name     string
+		bounds   []geoidx.Rect
+		expected geoidx.Rect
+	}{
+		{
+			name:     "single rect",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(-10, 40, 10, 60)},
+			expected: geoidx.MakeRect(-10, 40, 10, 60),
+		},
+		{
+			name:     "whole world",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(-180, -90, 180, 90)},
+			expected: geoidx.MakeRect(-180, -90, 180, 90),
+		},
+		{
+			name:     "two rects",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(-10, 40, 10, 60), geoidx.MakeRect(20, 30, 30, 50)},
+			expected: geoidx.MakeRect(-10, 30, 30, 60),
+		},
+		{
+			name:     "crossing the antimeridian",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(170, -50, -170, -30)},
+			expected: geoidx.MakeRect(170, -50, -170, -30),
+		},
+		{
+			name:     "crossing the antimeridian and another rect east of it",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(170, -50, -170, -30), geoidx.MakeRect(-160, -40, -150, -20)},
+			expected: geoidx.MakeRect(170, -50, -150, -20),
+		},
+		{
+			name:     "crossing the antimeridian and another rect west of it",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(170, -50, -170, -30), geoidx.MakeRect(0, 40, 10, 50)},
+			expected: geoidx.MakeRect(0, -50, -170, 50),
+		},
+		{
+			name:     "rects on both sides of the antimeridian",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(175, 0, 178, 10), geoidx.MakeRect(-178, 0, -175, 10)},
+			expected: geoidx.MakeRect(175, 0, -175, 10),
+		},
+		{
+			name:     "overlapping rects",
+			bounds:   []geoidx.Rect{geoidx.MakeRect(-100, 0, 50, 10), geoidx.MakeRect(-20, 0, 10, 10), geoidx.MakeRect(120, 0, 130, 10)},
+			expected: geoidx.MakeRect(-100, 0, 130, 10),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rects := make([]geoidx.Rect, 0)
+			for _, rect := range tc.bounds {
+				rects = append(rects, geo.SplitRect(rect)...)
+			}
+			got := indexBounds(rects)
+			if got != tc.expected {
+				t.Fatalf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestTrackedOutsideBounds(t *testing.T) {
+	idx := geoidx.NewIndex()
+	sub := newSubscription(idx.Subscribe(16), nil, nil)
+	defer idx.Unsubscribe(sub.Subscription)
+
+	pilotObject := func(lat, lng float64) *geoidx.Object {
+		pilot := testPilot("AAA1", lat, lng)
+		return geoidx.NewObject(pilot.Callsign, geo.ObjectBox(lat, lng, planeSizeNM/2), &pilot)
+	}
+	next := func() geoidx.Event {
+		t.Helper()
+		select {
+		case ev := <-sub.Events():
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+		return geoidx.Event{}
+	}
+
+	// two rects with a gap in between, the index envelope covers it
+	sub.SetBounds(geoidx.MakeRect(0, 40, 10, 50), geoidx.MakeRect(30, 40, 40, 50))
+	idx.Upsert(pilotObject(45, 20))
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("unexpected event for a pilot between the rects: %v", ev)
+	default:
+	}
+
+	sub.TrackID("AAA1")
+	if ev := next(); ev.Type != geoidx.EventTypeSet || ev.Obj.ID() != "AAA1" {
+		t.Fatalf("expected the tracked pilot to be set, got %v", ev)
+	}
+
+	// moving within the envelope and then out of it
+	for _, lng := range []float64{21, 60} {
+		idx.Upsert(pilotObject(45, lng))
+		ev := next()
+		if ev.Type != geoidx.EventTypeSet || ev.Obj.ID() != "AAA1" {
+			t.Fatalf("expected the tracked pilot update at %v, got %v", lng, ev)
+		}
+	}
+
+	sub.UntrackID("AAA1")
+	if ev := next(); ev.Type != geoidx.EventTypeDelete {
+		t.Fatalf("expected the untracked pilot to be deleted, got %v", ev)
+	}
+}
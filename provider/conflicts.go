@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const (
+	EventConflict    EventType = "conflict"
+	EventConflictEnd EventType = "conflict_end"
+)
+
+// Conflict is a pair of airborne pilots closer than configured
+// separation minima. Separation values are the latest ones while
+// the conflict is active and the closest ones once it's over.
+type Conflict struct {
+	Callsigns   [2]string `json:"callsigns"`
+	LateralNM   float64   `json:"lateral_nm"`
+	VerticalFt  int       `json:"vertical_ft"`
+	MinLateral  float64   `json:"min_lateral_nm"`
+	MinVertical int       `json:"min_vertical_ft"`
+	Start       time.Time `json:"start"`
+	LastSeen    time.Time `json:"last_seen"`
+	Duration    float64   `json:"duration"`
+}
+
+// conflictDetector keeps conflicts found on previous data cycles
+// to report their start, end and duration
+type conflictDetector struct {
+	cfg    config.ConflictsConfig
+	active map[[2]string]*Conflict
+	lock   sync.RWMutex
+}
+
+func newConflictDetector(cfg config.ConflictsConfig) *conflictDetector {
+	return &conflictDetector{
+		cfg:    cfg,
+		active: make(map[[2]string]*Conflict),
+	}
+}
+
+// GetConflicts returns currently active conflicts, the longest first
+func (p *Provider) GetConflicts() []Conflict {
+	cd := p.conflicts
+	cd.lock.RLock()
+	defer cd.lock.RUnlock()
+
+	now := time.Now()
+	conflicts := make([]Conflict, 0, len(cd.active))
+	for _, c := range cd.active {
+		conflict := *c
+		conflict.Duration = now.Sub(conflict.Start).Seconds()
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Start.Before(conflicts[j].Start)
+	})
+	return conflicts
+}
+
+// detectConflicts runs at the end of every data cycle using
+// the geo index to find candidate pairs
+func (p *Provider) detectConflicts() {
+	cd := p.conflicts
+	if !cd.cfg.Enabled || cd.cfg.LateralNM <= 0 {
+		return
+	}
+
+	p.dataLock.RLock()
+	pilots := make([]*merged.Pilot, 0, len(p.pilots))
+	for _, pilot := range p.pilots {
+		pilots = append(pilots, pilot)
+	}
+	p.dataLock.RUnlock()
+
+	now := time.Now()
+	found := make(map[[2]string]*Conflict)
+	isPilot := func(obj *geoidx.Object) bool {
+		_, ok := obj.Value().(*merged.Pilot)
+		return ok
+	}
+
+	for _, pilot := range pilots {
+		if !p.conflictCandidate(pilot) {
+			continue
+		}
+
+		for _, obj := range p.searchAround(pilot.Latitude, pilot.Longitude, cd.cfg.LateralNM, isPilot) {
+			other := obj.Value().(*merged.Pilot)
+			// every pair is checked once from its lesser callsign
+			if other.Callsign <= pilot.Callsign {
+				continue
+			}
+
+			vertical := int(math.Abs(float64(pilot.Altitude - other.Altitude)))
+			if vertical >= cd.cfg.VerticalFt {
+				continue
+			}
+			lateral := geo.DistanceNM(pilot.Latitude, pilot.Longitude, other.Latitude, other.Longitude)
+			if lateral >= cd.cfg.LateralNM {
+				continue
+			}
+			if !p.conflictCandidate(other) {
+				continue
+			}
+
+			key := [2]string{pilot.Callsign, other.Callsign}
+			found[key] = &Conflict{
+				Callsigns:  key,
+				LateralNM:  lateral,
+				VerticalFt: vertical,
+				LastSeen:   now,
+			}
+		}
+	}
+
+	cd.lock.Lock()
+	started := make([]Conflict, 0)
+	ended := make([]Conflict, 0)
+	for key, c := range found {
+		if ex, exists := cd.active[key]; exists {
+			c.Start = ex.Start
+			c.MinLateral = math.Min(ex.MinLateral, c.LateralNM)
+			c.MinVertical = ex.MinVertical
+			if c.VerticalFt < c.MinVertical {
+				c.MinVertical = c.VerticalFt
+			}
+		} else {
+			c.Start = now
+			c.MinLateral = c.LateralNM
+			c.MinVertical = c.VerticalFt
+			started = append(started, *c)
+		}
+		cd.active[key] = c
+	}
+	for key, c := range cd.active {
+		if _, exists := found[key]; !exists {
+			delete(cd.active, key)
+			conflict := *c
+			conflict.LateralNM = conflict.MinLateral
+			conflict.VerticalFt = conflict.MinVertical
+			conflict.Duration = conflict.LastSeen.Sub(conflict.Start).Seconds()
+			ended = append(ended, conflict)
+		}
+	}
+	cd.lock.Unlock()
+
+	for i := range started {
+		p.events.Publish(Event{Type: EventConflict, Callsign: started[i].Callsigns[0], Conflict: &started[i]})
+	}
+	for i := range ended {
+		p.events.Publish(Event{Type: EventConflictEnd, Callsign: ended[i].Callsigns[0], Conflict: &ended[i]})
+	}
+}
+
+// conflictCandidate excludes pilots on the ground and
+// low flying ones around airports
+func (p *Provider) conflictCandidate(pilot *merged.Pilot) bool {
+	if track.IsOnGround(pilot) {
+		return false
+	}
+	cfg := p.conflicts.cfg
+	if pilot.Altitude >= cfg.AirportMaxAltitude || cfg.AirportRadiusNM <= 0 {
+		return true
+	}
+	return p.nearestAirport(pilot.Latitude, pilot.Longitude, cfg.AirportRadiusNM) == nil
+}
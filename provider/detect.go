@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"math"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const (
+	// takeoffs and landings further than that from any
+	// airport are not reported
+	movementAirportRadiusNM = 5.0
+)
+
+var (
+	emergencySquawks = map[string]bool{
+		"7500": true,
+		"7600": true,
+		"7700": true,
+	}
+)
+
+// detectPilotEvents compares the new pilot state to the previous one
+// and publishes derived events. prev is nil for new pilots.
+func (p *Provider) detectPilotEvents(prev *merged.Pilot, pilot *merged.Pilot) {
+	if prev == nil {
+		if !p.synced {
+			// initial data isn't a news
+			return
+		}
+		p.events.Publish(Event{Type: EventPilotConnected, Callsign: pilot.Callsign, Pilot: pilot})
+		if pilot.FlightPlan != nil {
+			p.events.Publish(Event{Type: EventFlightPlanFiled, Callsign: pilot.Callsign, Pilot: pilot})
+		}
+		if emergencySquawks[pilot.Transponder] {
+			p.events.Publish(Event{Type: EventEmergencySquawk, Callsign: pilot.Callsign, Pilot: pilot})
+		}
+		return
+	}
+
+	if pilot.FlightPlan != nil {
+		if prev.FlightPlan == nil {
+			p.events.Publish(Event{Type: EventFlightPlanFiled, Callsign: pilot.Callsign, Pilot: pilot})
+		} else if *prev.FlightPlan != *pilot.FlightPlan {
+			p.events.Publish(Event{Type: EventFlightPlanAmended, Callsign: pilot.Callsign, Pilot: pilot})
+		}
+	}
+
+	wasOnGround := track.IsOnGround(prev)
+	isOnGround := track.IsOnGround(pilot)
+	if wasOnGround && !isOnGround {
+		// the aircraft was at the airport at the previous position
+		arpt := p.nearestAirport(prev.Latitude, prev.Longitude, movementAirportRadiusNM)
+		if arpt != nil {
+			p.events.Publish(Event{Type: EventTakeoff, Callsign: pilot.Callsign, Airport: arpt.Meta.ICAO, Pilot: pilot})
+			// shortly after liftoff the aircraft is still on the extended centerline
+			p.recordRunwayOp(arpt, runwayOpTakeoff, pilot.Latitude, pilot.Longitude, pilot.Heading, time.Now())
+		}
+	} else if !wasOnGround && isOnGround {
+		arpt := p.nearestAirport(pilot.Latitude, pilot.Longitude, movementAirportRadiusNM)
+		if arpt != nil {
+			p.events.Publish(Event{Type: EventLanding, Callsign: pilot.Callsign, Airport: arpt.Meta.ICAO, Pilot: pilot})
+			// the rollout may end up turning off, the final approach heading doesn't
+			p.recordRunwayOp(arpt, runwayOpLanding, pilot.Latitude, pilot.Longitude, prev.Heading, time.Now())
+		}
+	}
+
+	if prev.Transponder != pilot.Transponder && emergencySquawks[pilot.Transponder] {
+		p.events.Publish(Event{Type: EventEmergencySquawk, Callsign: pilot.Callsign, Pilot: pilot})
+	}
+}
+
+// detectAirportEvents reports local controllers logging on and off.
+// prev is nil for new airports.
+func (p *Provider) detectAirportEvents(prev *merged.Airport, arpt *merged.Airport) {
+	var prevSet merged.ControllerSet
+	if prev != nil {
+		prevSet = prev.Controllers
+	}
+	if prev == nil && !p.synced {
+		return
+	}
+
+	icao := arpt.Meta.ICAO
+	p.detectControllerChange(icao, prevSet.ATIS, arpt.Controllers.ATIS)
+	p.detectControllerChange(icao, prevSet.Delivery, arpt.Controllers.Delivery)
+	p.detectControllerChange(icao, prevSet.Ground, arpt.Controllers.Ground)
+	p.detectControllerChange(icao, prevSet.Tower, arpt.Controllers.Tower)
+	p.detectControllerChange(icao, prevSet.Approach, arpt.Controllers.Approach)
+}
+
+func (p *Provider) detectControllerChange(icao string, prev *vatsimapi.Controller, ctrl *vatsimapi.Controller) {
+	if prev != nil && (ctrl == nil || prev.Callsign != ctrl.Callsign) {
+		p.events.Publish(Event{Type: EventATCLogoff, Callsign: prev.Callsign, Airport: icao, Controller: prev})
+	}
+	if ctrl != nil && (prev == nil || prev.Callsign != ctrl.Callsign) {
+		p.events.Publish(Event{Type: EventATCLogon, Callsign: ctrl.Callsign, Airport: icao, Controller: ctrl})
+	}
+}
+
+// nearestAirport finds the closest airport within radiusNM
+func (p *Provider) nearestAirport(lat float64, lng float64, radiusNM float64) *merged.Airport {
+	var nearest *merged.Airport
+	minDist := math.Inf(1)
+
+	objects := p.searchAround(lat, lng, radiusNM, func(obj *geoidx.Object) bool {
+		_, ok := obj.Value().(*merged.Airport)
+		return ok
+	})
+	for _, obj := range objects {
+		arpt := obj.Value().(*merged.Airport)
+		if arpt.Meta.IsPseudo {
+			continue
+		}
+		dist := geo.DistanceNM(lat, lng, arpt.Meta.Position.Lat, arpt.Meta.Position.Lng)
+		if dist <= radiusNM && dist < minDist {
+			minDist = dist
+			nearest = arpt
+		}
+	}
+	return nearest
+}
@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+)
+
+type EventType string
+
+// Event is a higher level network event derived from object updates
+type Event struct {
+	Seq        uint64                `json:"seq"`
+	Type       EventType             `json:"type"`
+	Time       time.Time             `json:"ts"`
+	Callsign   string                `json:"callsign"`
+	Airport    string                `json:"airport,omitempty"`
+	Pilot      *merged.Pilot         `json:"pilot,omitempty"`
+	Controller *vatsimapi.Controller `json:"controller,omitempty"`
+	Conflict   *Conflict             `json:"conflict,omitempty"`
+}
+
+const (
+	EventPilotConnected    EventType = "pilot_connected"
+	EventPilotDisconnected EventType = "pilot_disconnected"
+	EventFlightPlanFiled   EventType = "flightplan_filed"
+	EventFlightPlanAmended EventType = "flightplan_amended"
+	EventTakeoff           EventType = "takeoff"
+	EventLanding           EventType = "landing"
+	EventATCLogon          EventType = "atc_logon"
+	EventATCLogoff         EventType = "atc_logoff"
+	EventEmergencySquawk   EventType = "emergency_squawk"
+
+	eventHistorySize = 1000
+)
+
+// KnownEventTypes lists every event type the provider publishes
+var KnownEventTypes = []EventType{
+	EventPilotConnected,
+	EventPilotDisconnected,
+	EventFlightPlanFiled,
+	EventFlightPlanAmended,
+	EventTakeoff,
+	EventLanding,
+	EventATCLogon,
+	EventATCLogoff,
+	EventEmergencySquawk,
+	EventConflict,
+	EventConflictEnd,
+}
+
+func (t EventType) IsKnown() bool {
+	for _, kt := range KnownEventTypes {
+		if t == kt {
+			return true
+		}
+	}
+	return false
+}
+
+// EventBus fans events out to subscribers and keeps a short history
+// for long-polling clients
+type EventBus struct {
+	seq     uint64
+	history []Event
+	subs    map[string]*EventSubscription
+	// notify is closed and replaced on every publish to wake up waiters
+	notify chan struct{}
+	lock   sync.RWMutex
+}
+
+type EventSubscription struct {
+	id    string
+	ch    chan Event
+	types map[EventType]bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		history: make([]Event, 0, eventHistorySize),
+		subs:    make(map[string]*EventSubscription),
+		notify:  make(chan struct{}),
+	}
+}
+
+// Subscribe creates an event subscription, if no types are given
+// all events are delivered
+func (b *EventBus) Subscribe(chSize int, types ...EventType) *EventSubscription {
+	es := &EventSubscription{
+		id:    uuid.New().String(),
+		ch:    make(chan Event, chSize),
+		types: makeEventTypeSet(types),
+	}
+	b.lock.Lock()
+	b.subs[es.id] = es
+	b.lock.Unlock()
+	return es
+}
+
+func (b *EventBus) Unsubscribe(es *EventSubscription) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, found := b.subs[es.id]; found {
+		delete(b.subs, es.id)
+		close(es.ch)
+	}
+}
+
+func (b *EventBus) Publish(ev Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.seq++
+	ev.Seq = b.seq
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	if len(b.history) == eventHistorySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:eventHistorySize-1]
+	}
+	b.history = append(b.history, ev)
+
+	for _, es := range b.subs {
+		if !es.accepts(ev.Type) {
+			continue
+		}
+		select {
+		case es.ch <- ev:
+		default:
+			// slow subscribers must not stall the provider loop
+			log.WithField("sub_id", es.id).Debug("event subscription is full, event dropped")
+		}
+	}
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Recent returns up to limit latest events of given types
+func (b *EventBus) Recent(limit int, types ...EventType) ([]Event, uint64) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.filterUnsafe(0, limit, makeEventTypeSet(types)), b.seq
+}
+
+// Wait returns events newer than since, blocking until there's
+// at least one or ctx is done. It also returns the last event seq.
+func (b *EventBus) Wait(ctx context.Context, since uint64, types ...EventType) ([]Event, uint64) {
+	typeSet := makeEventTypeSet(types)
+	for {
+		b.lock.RLock()
+		events := b.filterUnsafe(since, eventHistorySize, typeSet)
+		seq := b.seq
+		notify := b.notify
+		b.lock.RUnlock()
+
+		if len(events) > 0 {
+			return events, seq
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return events, seq
+		}
+	}
+}
+
+func (b *EventBus) filterUnsafe(since uint64, limit int, types map[EventType]bool) []Event {
+	events := make([]Event, 0)
+	for i := len(b.history) - 1; i >= 0 && len(events) < limit; i-- {
+		ev := b.history[i]
+		if ev.Seq <= since {
+			break
+		}
+		if len(types) == 0 || types[ev.Type] {
+			events = append(events, ev)
+		}
+	}
+	// collected newest first, return in chronological order
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events
+}
+
+func (es *EventSubscription) ID() string {
+	return es.id
+}
+
+func (es *EventSubscription) Events() <-chan Event {
+	return es.ch
+}
+
+func (es *EventSubscription) accepts(t EventType) bool {
+	return len(es.types) == 0 || es.types[t]
+}
+
+func makeEventTypeSet(types []EventType) map[EventType]bool {
+	set := make(map[EventType]bool)
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
@@ -33,7 +33,10 @@ func airportFilter(includeUncontrolled bool) geoidx.Filter {
 	return nil
 }
 
-func pilotFilter(query string) (geoidx.Filter, error) {
+// progressFunc looks a pilot's progress up for eta and dtg conditions
+type progressFunc func(*merged.Pilot) (*Progress, bool)
+
+func pilotFilter(query string, progress progressFunc) (geoidx.Filter, error) {
 	log := logrus.WithFields(logrus.Fields{
 		"func":  "planeFilter",
 		"query": query,
@@ -41,7 +44,7 @@ func pilotFilter(query string) (geoidx.Filter, error) {
 
 	t1 := time.Now()
 
-	tokens, err := lexer.Tokenize(query, true)
+	tokens, err := lexer.Tokenize(normalizeDurations(query), true)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +58,30 @@ func pilotFilter(query string) (geoidx.Filter, error) {
 		log.WithField("condition", c.String()).Debug("compiling condition")
 
 		switch c.Identifier.Name {
+		case "eta":
+			// minutes to arrival, duration literals like 30m are understood
+			if progress == nil {
+				return nil, errProgressUnavailable(c.Identifier.Name)
+			}
+			return numericMatcher(c, func(pilot *merged.Pilot) (float64, bool) {
+				prog, found := progress(pilot)
+				if !found || prog.ETA == nil {
+					return 0, false
+				}
+				return minutesTo(*prog.ETA), true
+			})
+		case "dtg":
+			// distance to go, nautical miles
+			if progress == nil {
+				return nil, errProgressUnavailable(c.Identifier.Name)
+			}
+			return numericMatcher(c, func(pilot *merged.Pilot) (float64, bool) {
+				prog, found := progress(pilot)
+				if !found {
+					return 0, false
+				}
+				return prog.DistanceToGo, true
+			})
 		case "aircraft":
 			if !c.Value.IsString() {
 				return nil, fmt.Errorf("missing string value for %s", c.Identifier.Name)
@@ -331,6 +358,30 @@ func pilotFilter(query string) (geoidx.Filter, error) {
 			default:
 				return nil, fmt.Errorf("invalid operator %s for %s", c.Operator.Type, c.Identifier.Name)
 			}
+		case "cid":
+			if !c.Value.IsFloat() {
+				return nil, fmt.Errorf("missing numeric value for %s", c.Identifier.Name)
+			}
+			value := int(c.Value.MustGetFloatValue())
+
+			switch c.Operator.Type {
+			case parser.Equals:
+				return func(obj *geoidx.Object) bool {
+					if pilot, ok := obj.Value().(*merged.Pilot); ok {
+						return pilot.Cid == value
+					}
+					return false
+				}, nil
+			case parser.NotEquals:
+				return func(obj *geoidx.Object) bool {
+					if pilot, ok := obj.Value().(*merged.Pilot); ok {
+						return pilot.Cid != value
+					}
+					return false
+				}, nil
+			default:
+				return nil, fmt.Errorf("invalid operator %s for %s", c.Operator.Type, c.Identifier.Name)
+			}
 		case "alt":
 			if !c.Value.IsFloat() {
 				return nil, fmt.Errorf("missing numeric value for %s", c.Identifier.Name)
@@ -588,3 +639,51 @@ func pilotFilter(query string) (geoidx.Filter, error) {
 	}, nil
 
 }
+
+// numericMatcher compiles a comparison of a numeric pilot property,
+// pilots the property is unknown for never match
+func numericMatcher(c *parser.Condition[*geoidx.Object], get func(*merged.Pilot) (float64, bool)) (parser.Matcher[*geoidx.Object], error) {
+	if !c.Value.IsFloat() {
+		return nil, fmt.Errorf("missing numeric value for %s", c.Identifier.Name)
+	}
+	value := c.Value.MustGetFloatValue()
+
+	var cmp func(float64) bool
+	switch c.Operator.Type {
+	case parser.Equals:
+		cmp = func(v float64) bool { return v == value }
+	case parser.NotEquals:
+		cmp = func(v float64) bool { return v != value }
+	case parser.Less:
+		cmp = func(v float64) bool { return v < value }
+	case parser.LessOrEqual:
+		cmp = func(v float64) bool { return v <= value }
+	case parser.Greater:
+		cmp = func(v float64) bool { return v > value }
+	case parser.GreaterOrEqual:
+		cmp = func(v float64) bool { return v >= value }
+	default:
+		return nil, fmt.Errorf("invalid operator %s for %s", c.Operator.Type, c.Identifier.Name)
+	}
+
+	return func(obj *geoidx.Object) bool {
+		if pilot, ok := obj.Value().(*merged.Pilot); ok {
+			v, known := get(pilot)
+			return known && cmp(v)
+		}
+		return false
+	}, nil
+}
+
+// PilotMatcher compiles a pilot filter query into a standalone
+// predicate for consumers outside of geo subscriptions, eta and
+// dtg conditions need a provider and aren't supported
+func PilotMatcher(query string) (func(*merged.Pilot) bool, error) {
+	filter, err := pilotFilter(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func(pilot *merged.Pilot) bool {
+		return filter(geoidx.NewObject(pilot.Callsign, geoidx.MakeRect(0, 0, 0, 0), pilot))
+	}, nil
+}
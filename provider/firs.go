@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+// FIRStatus is a FIR with controllers covering it and
+// the number of pilots within its boundaries
+type FIRStatus struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Prefix    string   `json:"prefix"`
+	IsOceanic bool     `json:"is_oceanic"`
+	Staffed   bool     `json:"staffed"`
+	Callsigns []string `json:"callsigns"`
+	Pilots    int      `json:"pilots"`
+}
+
+// firCatalog keeps every FIR known to vatspy data along with the ones
+// reported by radars, FIRs stay listed after their controllers go offline
+type firCatalog struct {
+	firs map[string]vatspydata.FIR
+	lock sync.RWMutex
+	stop chan struct{}
+}
+
+func newFIRCatalog() *firCatalog {
+	return &firCatalog{
+		firs: make(map[string]vatspydata.FIR),
+		stop: make(chan struct{}),
+	}
+}
+
+func (fc *firCatalog) learn(radar *merged.Radar) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	for id, fir := range radar.FIRs {
+		fc.firs[id] = fir
+	}
+}
+
+// load fills the catalog with the first complete vatspy data set
+// and stops the fetcher, FIRs learned from radars meanwhile are
+// kept as they are live
+func (fc *firCatalog) load(cfg *vatspydata.Config) {
+	l := log.WithField("func", "firCatalog.load")
+
+	static := vatspydata.New(cfg)
+	ssub := static.Subscribe(32768)
+	static.Start()
+
+	count := 0
+	for {
+		select {
+		case upd := <-ssub.Updates():
+			switch upd.UType {
+			case pubsub.UpdateTypeFin:
+				static.Unsubscribe(ssub)
+				static.Stop()
+				l.WithField("firs", count).Info("static FIR data loaded")
+				return
+			case pubsub.UpdateTypeSet:
+				fir, ok := upd.Obj.(vatspydata.FIR)
+				if !ok {
+					continue
+				}
+				count++
+				fc.lock.Lock()
+				if _, found := fc.firs[fir.ID]; !found {
+					fc.firs[fir.ID] = fir
+				}
+				fc.lock.Unlock()
+			}
+		case <-fc.stop:
+			// the fetcher may still be booting and can't be stopped
+			// until it's done, it goes away with the process
+			static.Unsubscribe(ssub)
+			return
+		}
+	}
+}
+
+// GetFIRs lists every FIR known to vatspy data with its staffing and
+// traffic. FIRs of online controllers override the static ones.
+func (p *Provider) GetFIRs() []FIRStatus {
+	return p.firStatuses(p.firStaffing())
+}
+
+func (p *Provider) firStatuses(firs map[string]vatspydata.FIR, staffing map[string][]string) []FIRStatus {
+	statuses := make([]FIRStatus, 0, len(firs))
+	for _, fir := range firs {
+		callsigns := staffing[fir.ID]
+		if callsigns == nil {
+			callsigns = make([]string, 0)
+		}
+		sort.Strings(callsigns)
+		statuses = append(statuses, FIRStatus{
+			ID:        fir.ID,
+			Name:      fir.Name,
+			Prefix:    fir.Prefix,
+			IsOceanic: fir.Boundaries.IsOceanic,
+			Staffed:   len(callsigns) > 0,
+			Callsigns: callsigns,
+			Pilots:    p.countPilotsInFIR(fir),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
+
+// GetFIRCoverage renders FIR boundaries as GeoJSON multipolygons
+// having FIRStatus fields as properties
+func (p *Provider) GetFIRCoverage() *GeoJSONFeatureCollection {
+	firs, staffing := p.firStaffing()
+	fc := newFeatureCollection()
+
+	for _, st := range p.firStatuses(firs, staffing) {
+		fir := firs[st.ID]
+		if len(fir.Boundaries.Points) == 0 {
+			continue
+		}
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: boundariesMultiPolygon(fir.Boundaries),
+			Properties: map[string]interface{}{
+				"id":         st.ID,
+				"name":       st.Name,
+				"prefix":     st.Prefix,
+				"is_oceanic": st.IsOceanic,
+				"staffed":    st.Staffed,
+				"callsigns":  st.Callsigns,
+				"pilots":     st.Pilots,
+			},
+		})
+	}
+	return fc
+}
+
+// firStaffing overrides catalog FIRs with the ones of online
+// radars and maps FIR ids to controller callsigns
+func (p *Provider) firStaffing() (map[string]vatspydata.FIR, map[string][]string) {
+	firs := make(map[string]vatspydata.FIR)
+	p.firs.lock.RLock()
+	for id, fir := range p.firs.firs {
+		firs[id] = fir
+	}
+	p.firs.lock.RUnlock()
+
+	staffing := make(map[string][]string)
+	p.dataLock.RLock()
+	for _, radar := range p.radars {
+		for id, fir := range radar.FIRs {
+			firs[id] = fir
+			staffing[id] = append(staffing[id], radar.Controller.Callsign)
+		}
+	}
+	p.dataLock.RUnlock()
+	return firs, staffing
+}
+
+// countPilotsInFIR finds candidates by the bounding box and
+// checks them against actual FIR polygons
+func (p *Provider) countPilotsInFIR(fir vatspydata.FIR) int {
+	polygons := p.firGeoms.get(fir)
+	rect, ok := polygonsBounds(polygons)
+	if !ok {
+		return 0
+	}
+
+	l := log.WithFields(logrus.Fields{
+		"func": "countPilotsInFIR",
+		"fir":  fir.ID,
+	})
+
+	isPilot := func(obj *geoidx.Object) bool {
+		_, ok := obj.Value().(*merged.Pilot)
+		return ok
+	}
+
+	count := 0
+	candidates := p.idx.SearchByRect(rect, isPilot)
+	for _, obj := range candidates {
+		pilot := obj.Value().(*merged.Pilot)
+		for _, pg := range polygons {
+			if pg.contains(pilot.Latitude, pilot.Longitude) {
+				count++
+				break
+			}
+		}
+	}
+	l.WithFields(logrus.Fields{
+		"candidates": len(candidates),
+		"pilots":     count,
+	}).Trace("pilots counted")
+	return count
+}
+
+func boundariesMultiPolygon(bnds vatspydata.Boundaries) GeoJSONGeometry {
+	coords := make([][][][]float64, 0, len(bnds.Points))
+	for _, ring := range bnds.Points {
+		points := make([][]float64, 0, len(ring))
+		for _, pt := range ring {
+			points = append(points, []float64{pt.Lng, pt.Lat})
+		}
+		coords = append(coords, [][][]float64{points})
+	}
+	return GeoJSONGeometry{Type: "MultiPolygon", Coordinates: coords}
+}
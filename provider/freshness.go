@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+type UpstreamSource string
+
+const (
+	UpstreamVatsim      UpstreamSource = "vatsim"
+	UpstreamVatspy      UpstreamSource = "vatspy"
+	UpstreamOurAirports UpstreamSource = "ourairports"
+)
+
+type (
+	// UpstreamStatus describes the last update seen from an upstream source.
+	// Static sources only produce updates when their data actually changes.
+	UpstreamStatus struct {
+		LastUpdate time.Time `json:"last_update"`
+		// UpstreamTimestamp is the newest last_updated of VATSIM records
+		// in the last data cycle, merged provider doesn't pass the
+		// general update_timestamp through so it's the closest we have
+		UpstreamTimestamp *time.Time `json:"upstream_timestamp,omitempty"`
+		Stale             bool       `json:"stale"`
+	}
+
+	// Status is a data freshness and track writer summary
+	Status struct {
+		Synced      bool                              `json:"synced"`
+		StaleAfter  float64                           `json:"stale_after"`
+		Sources     map[UpstreamSource]UpstreamStatus `json:"sources"`
+		Pilots      int                               `json:"pilots"`
+		StalePilots int                               `json:"stale_pilots"`
+		Radars      int                               `json:"radars"`
+		StaleRadars int                               `json:"stale_radars"`
+		// TrackWriter shows whether track points are being dropped
+		TrackWriter track.WriterStats `json:"track_writer"`
+	}
+)
+
+// freshness keeps the time upstream sources were last updated and
+// objects confirmed by the source. Sources only notify of changed
+// objects so an object is considered refreshed by every complete data
+// cycle it survives.
+type freshness struct {
+	staleAfter time.Duration
+	sources    map[UpstreamSource]time.Time
+	upstreamTS time.Time
+	cycleTS    time.Time
+	confirmed  map[staleKey]bool
+	lock       sync.RWMutex
+}
+
+func newFreshness(staleAfter time.Duration) *freshness {
+	return &freshness{
+		staleAfter: staleAfter,
+		sources:    make(map[UpstreamSource]time.Time),
+		confirmed:  make(map[staleKey]bool),
+	}
+}
+
+// sourcePeriod is the expected interval between source data cycles
+func sourcePeriod(cfg *config.Config) time.Duration {
+	switch cfg.Source.Mode {
+	case "synthetic":
+		return cfg.Source.Synthetic.UpdatePeriod
+	case "replay":
+		if cfg.Source.Replay.Speed > 0 {
+			return time.Duration(float64(cfg.API.Poll.Period) / cfg.Source.Replay.Speed)
+		}
+	}
+	return cfg.API.Poll.Period
+}
+
+func (f *freshness) sourceUpdated(src UpstreamSource) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sources[src] = time.Now()
+}
+
+// touch marks a pilot or a radar confirmed by the source, forget
+// drops it once deleted
+func (f *freshness) touch(obj interface{}) {
+	var lastUpdated time.Time
+	switch o := obj.(type) {
+	case merged.Pilot:
+		lastUpdated = o.LastUpdated
+	case merged.Radar:
+		lastUpdated = o.Controller.LastUpdated
+	default:
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.confirmed[objectKey(obj)] = true
+	if lastUpdated.After(f.cycleTS) {
+		f.cycleTS = lastUpdated
+	}
+}
+
+func (f *freshness) forget(obj interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.confirmed, objectKey(obj))
+}
+
+// cycleComplete is called on fin when a vatsim data cycle is over
+func (f *freshness) cycleComplete() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sources[UpstreamVatsim] = time.Now()
+	if !f.cycleTS.IsZero() {
+		f.upstreamTS = f.cycleTS
+	}
+	f.cycleTS = time.Time{}
+}
+
+// isStale reports whether an object hasn't been refreshed in time.
+// Objects restored from a snapshot are stale until the source confirms
+// them, everything is stale once the source stops completing data
+// cycles. Pilots are re-sent on every cycle so their own last_updated
+// is checked against the upstream timestamp as well.
+func (f *freshness) isStale(obj interface{}) bool {
+	var lastUpdated time.Time
+	switch o := obj.(type) {
+	case merged.Pilot:
+		lastUpdated = o.LastUpdated
+	case *merged.Pilot:
+		lastUpdated = o.LastUpdated
+	}
+
+	key := objectKey(obj)
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if !f.confirmed[key] {
+		return true
+	}
+	if f.expired(f.sources[UpstreamVatsim], time.Now()) {
+		return true
+	}
+	return !lastUpdated.IsZero() && f.expired(lastUpdated, f.upstreamTS)
+}
+
+func (f *freshness) expired(t time.Time, now time.Time) bool {
+	return f.staleAfter > 0 && now.Sub(t) > f.staleAfter
+}
+
+func (f *freshness) sourcesStatus() map[UpstreamSource]UpstreamStatus {
+	now := time.Now()
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	sources := make(map[UpstreamSource]UpstreamStatus)
+	for src, ts := range f.sources {
+		us := UpstreamStatus{LastUpdate: ts}
+		if src == UpstreamVatsim {
+			// static sources change rarely so only
+			// dynamic data may become stale
+			us.Stale = f.expired(ts, now)
+			if !f.upstreamTS.IsZero() {
+				upstreamTS := f.upstreamTS
+				us.UpstreamTimestamp = &upstreamTS
+			}
+		}
+		sources[src] = us
+	}
+	return sources
+}
+
+// reset drops source update times, i.e. ones produced by snapshot restore
+func (f *freshness) reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sources = make(map[UpstreamSource]time.Time)
+}
+
+// airportSources tells which upstream sources an airport update came from
+func airportSources(prev *merged.Airport, arpt *merged.Airport) []UpstreamSource {
+	if prev == nil {
+		return []UpstreamSource{UpstreamVatspy}
+	}
+
+	sources := make([]UpstreamSource, 0, 3)
+	if prev.Meta.NE(arpt.Meta) {
+		sources = append(sources, UpstreamVatspy)
+	}
+	if prev.Controllers.NE(arpt.Controllers) {
+		sources = append(sources, UpstreamVatsim)
+	}
+	if runwaysChanged(prev, arpt) {
+		sources = append(sources, UpstreamOurAirports)
+	}
+	return sources
+}
+
+func runwaysChanged(prev *merged.Airport, arpt *merged.Airport) bool {
+	if len(prev.Runways) != len(arpt.Runways) {
+		return true
+	}
+	for ident, rwy := range arpt.Runways {
+		ex, found := prev.Runways[ident]
+		if !found || ex.NE(*rwy) {
+			return true
+		}
+	}
+	return false
+}
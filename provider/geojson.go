@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"github.com/vatsimnerd/geoidx"
+)
+
+// Minimal GeoJSON (RFC 7946) types, positions are [lng, lat]
+type (
+	GeoJSONFeatureCollection struct {
+		Type     string           `json:"type"`
+		Features []GeoJSONFeature `json:"features"`
+	}
+
+	GeoJSONFeature struct {
+		Type       string                 `json:"type"`
+		Geometry   GeoJSONGeometry        `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+
+	// GeoJSONGeometry coordinates are nested according to the type,
+	// [][][]float64 for polygons and [][][][]float64 for multipolygons
+	GeoJSONGeometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}
+)
+
+func newFeatureCollection() *GeoJSONFeatureCollection {
+	return &GeoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]GeoJSONFeature, 0),
+	}
+}
+
+func rectPolygon(rect geoidx.Rect) GeoJSONGeometry {
+	sw, ne := rect.SouthWest, rect.NorthEast
+	return GeoJSONGeometry{
+		Type: "Polygon",
+		Coordinates: [][][]float64{{
+			{sw.Longitude, sw.Latitude},
+			{ne.Longitude, sw.Latitude},
+			{ne.Longitude, ne.Latitude},
+			{sw.Longitude, ne.Latitude},
+			{sw.Longitude, sw.Latitude},
+		}},
+	}
+}
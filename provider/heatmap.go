@@ -0,0 +1,383 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const (
+	// source outages shorter than that are interpolated over,
+	// gaps left by track compression may be longer
+	heatmapMaxPointGap = 15 * time.Minute
+)
+
+var (
+	ErrInvalidHeatmap = fmt.Errorf("invalid heatmap query")
+)
+
+type (
+	// HeatmapQuery describes a density grid. AltitudeBands are ascending
+	// band boundaries in feet, [10000, 25000] makes three bands. Hours
+	// set to zero means current traffic, otherwise pilot counts are
+	// averaged over stored tracks of the last Hours.
+	HeatmapQuery struct {
+		Bounds        geoidx.Rect `json:"bounds"`
+		Resolution    float64     `json:"resolution"`
+		AltitudeBands []int       `json:"altitude_bands,omitempty"`
+		Hours         float64     `json:"hours,omitempty"`
+	}
+
+	// HeatmapBand is an altitude range, MaxAltitude is nil for the top band
+	HeatmapBand struct {
+		MinAltitude int  `json:"min_alt"`
+		MaxAltitude *int `json:"max_alt,omitempty"`
+	}
+
+	// Heatmap holds pilot counts per cell for every altitude band,
+	// rows go from south to north and columns from west to east. If
+	// the bounds cross the antimeridian, their west longitude is
+	// greater than the east one and columns continue past it.
+	Heatmap struct {
+		Bounds     geoidx.Rect   `json:"bounds"`
+		Resolution float64       `json:"resolution"`
+		Rows       int           `json:"rows"`
+		Cols       int           `json:"cols"`
+		Bands      []HeatmapBand `json:"bands"`
+		Grids      [][][]float64 `json:"grids"`
+		Total      float64       `json:"total"`
+		From       *time.Time    `json:"from,omitempty"`
+		To         time.Time     `json:"to"`
+		Samples    int           `json:"samples,omitempty"`
+
+		parts []heatmapPart
+	}
+
+	// heatmapPart is a part of the bounds on one side of the
+	// antimeridian gridded on its own starting at column col
+	heatmapPart struct {
+		rect geoidx.Rect
+		col  int
+		cols int
+	}
+)
+
+// GetHeatmap counts pilots currently within the query bounds
+func (p *Provider) GetHeatmap(q HeatmapQuery) (*Heatmap, error) {
+	hm, err := p.newHeatmap(q)
+	if err != nil {
+		return nil, err
+	}
+
+	isPilot := func(obj *geoidx.Object) bool {
+		_, ok := obj.Value().(*merged.Pilot)
+		return ok
+	}
+	// pilots on the antimeridian are found in both parts
+	seen := make(map[string]bool)
+	for _, part := range hm.parts {
+		for _, obj := range p.idx.SearchByRect(part.rect, isPilot) {
+			if seen[obj.ID()] {
+				continue
+			}
+			seen[obj.ID()] = true
+			pilot := obj.Value().(*merged.Pilot)
+			hm.add(pilot.Latitude, pilot.Longitude, pilot.Altitude, 1)
+		}
+	}
+	hm.To = time.Now()
+	return hm, nil
+}
+
+// GetHeatmapHistory averages pilot counts over stored tracks. Every
+// track is sampled at the configured interval, interpolating between
+// points, so each cell holds the mean number of pilots within it.
+func (p *Provider) GetHeatmapHistory(ctx context.Context, q HeatmapQuery) (*Heatmap, error) {
+	l := log.WithFields(logrus.Fields{
+		"func":  "GetHeatmapHistory",
+		"hours": q.Hours,
+	})
+
+	if q.Hours <= 0 {
+		return nil, fmt.Errorf("%w: hours must be positive", ErrInvalidHeatmap)
+	}
+	hm, err := p.newHeatmap(q)
+	if err != nil {
+		return nil, err
+	}
+
+	step := int64(p.hcfg.SampleInterval.Seconds())
+	if step < 1 {
+		step = 1
+	}
+	to := time.Now().Truncate(time.Second)
+	from := to.Add(-time.Duration(q.Hours * float64(time.Hour)))
+	hm.From = &from
+	hm.To = to
+	hm.Samples = int((to.Unix()-from.Unix())/step) + 1
+
+	ids, err := track.ListIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := 1 / float64(hm.Samples)
+	gap := trackGap{
+		maxGap:      heatmapMaxPointGap,
+		toleranceNM: p.tcfg.Options.CompressTolerance,
+	}
+	if maxGap := track.MaxCompressedGap(p.srcPeriod); maxGap > gap.maxGap {
+		gap.maxGap = maxGap
+	}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		_, _, logonTime, err := track.ParseTrackID(id)
+		if err != nil {
+			l.WithError(err).Debug("skipping track")
+			continue
+		}
+		if logonTime.After(to) {
+			continue
+		}
+
+		tr, err := track.LoadTrackWindow(ctx, id, from.Unix(), to.Unix())
+		if err != nil {
+			l.WithField("track_id", id).WithError(err).Error("error loading track")
+			continue
+		}
+		sampleTrack(tr.Points, from.Unix(), to.Unix(), step, gap, func(lat, lng float64, alt int) {
+			hm.add(lat, lng, alt, weight)
+		})
+	}
+	return hm, nil
+}
+
+// trackGap tells disconnects from gaps left by track compression
+type trackGap struct {
+	maxGap      time.Duration
+	toleranceNM float64
+}
+
+func (g trackGap) isDisconnect(a, b track.TrackPoint) bool {
+	if time.Duration(b.TimeStamp-a.TimeStamp)*time.Second <= g.maxGap {
+		return false
+	}
+	// stationary runs have no length limit, their latest point
+	// may have been replaced by the first one after moving off
+	return geo.DistanceNM(a.Latitude, a.Longitude, b.Latitude, b.Longitude) > g.toleranceNM
+}
+
+// sampleTrack calls fn with interpolated positions at every sample
+// time between from and to while the track has points around it
+// and they aren't separated by a disconnect
+func sampleTrack(points []track.TrackPoint, from, to, step int64, gap trackGap, fn func(lat, lng float64, alt int)) {
+	if len(points) == 0 || points[0].TimeStamp > to || points[len(points)-1].TimeStamp < from {
+		return
+	}
+
+	// the first sample at or after the first track point
+	ts := from
+	if points[0].TimeStamp > from {
+		ts = from + (points[0].TimeStamp-from+step-1)/step*step
+	}
+
+	i := 0
+	for ; ts <= to; ts += step {
+		for i < len(points)-1 && points[i+1].TimeStamp <= ts {
+			i++
+		}
+		if i == len(points)-1 {
+			if points[i].TimeStamp == ts {
+				fn(points[i].Latitude, points[i].Longitude, points[i].Altitude)
+			}
+			return
+		}
+
+		a, b := points[i], points[i+1]
+		if gap.isDisconnect(a, b) {
+			continue
+		}
+		k := float64(ts-a.TimeStamp) / float64(b.TimeStamp-a.TimeStamp)
+		lat, lng := geo.Intermediate(a.Latitude, a.Longitude, b.Latitude, b.Longitude, k)
+		fn(lat, lng, a.Altitude+int(float64(b.Altitude-a.Altitude)*k))
+	}
+}
+
+// ValidateHeatmapQuery checks the query against configured limits
+func (p *Provider) ValidateHeatmapQuery(q HeatmapQuery) error {
+	_, err := p.newHeatmap(q)
+	return err
+}
+
+func (p *Provider) newHeatmap(q HeatmapQuery) (*Heatmap, error) {
+	if !(q.Hours >= 0 && q.Hours <= p.hcfg.MaxHours) {
+		return nil, fmt.Errorf("%w: hours must be within [0, %v]", ErrInvalidHeatmap, p.hcfg.MaxHours)
+	}
+	sw, ne := q.Bounds.SouthWest, q.Bounds.NorthEast
+	for _, v := range []float64{sw.Latitude, sw.Longitude, ne.Latitude, ne.Longitude} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: bounds must be finite", ErrInvalidHeatmap)
+		}
+	}
+	if sw.Latitude < -90 || ne.Latitude > 90 {
+		return nil, fmt.Errorf("%w: latitudes must be within [-90, 90]", ErrInvalidHeatmap)
+	}
+	if !(q.Resolution > 0) || math.IsInf(q.Resolution, 0) {
+		return nil, fmt.Errorf("%w: resolution must be positive", ErrInvalidHeatmap)
+	}
+	if sw.Latitude >= ne.Latitude || sw.Longitude == ne.Longitude {
+		return nil, fmt.Errorf("%w: bounds are empty", ErrInvalidHeatmap)
+	}
+	if !sort.IntsAreSorted(q.AltitudeBands) {
+		return nil, fmt.Errorf("%w: altitude bands must be ascending", ErrInvalidHeatmap)
+	}
+
+	// counted in floats, tiny resolutions overflow ints
+	rects := geo.SplitRect(q.Bounds)
+	fRows := math.Ceil((ne.Latitude - sw.Latitude) / q.Resolution)
+	fCols := 0.0
+	for _, rect := range rects {
+		fCols += math.Ceil((rect.NorthEast.Longitude - rect.SouthWest.Longitude) / q.Resolution)
+	}
+	bands := heatmapBands(q.AltitudeBands)
+	if cells := fRows * fCols * float64(len(bands)); math.IsInf(cells, 0) || cells > float64(p.hcfg.MaxCells) {
+		return nil, fmt.Errorf("%w: more than %d cells requested", ErrInvalidHeatmap, p.hcfg.MaxCells)
+	}
+	rows, cols := int(fRows), int(fCols)
+
+	parts := make([]heatmapPart, 0, len(rects))
+	col := 0
+	for _, rect := range rects {
+		partCols := int(math.Ceil((rect.NorthEast.Longitude - rect.SouthWest.Longitude) / q.Resolution))
+		parts = append(parts, heatmapPart{rect: rect, col: col, cols: partCols})
+		col += partCols
+	}
+
+	hm := &Heatmap{
+		Bounds:     geoidx.MakeRect(rects[0].SouthWest.Longitude, sw.Latitude, rects[len(rects)-1].NorthEast.Longitude, ne.Latitude),
+		Resolution: q.Resolution,
+		Rows:       rows,
+		Cols:       cols,
+		Bands:      bands,
+		Grids:      make([][][]float64, len(bands)),
+		parts:      parts,
+	}
+	for b := range hm.Grids {
+		hm.Grids[b] = make([][]float64, rows)
+		for r := range hm.Grids[b] {
+			hm.Grids[b][r] = make([]float64, cols)
+		}
+	}
+	return hm, nil
+}
+
+func heatmapBands(boundaries []int) []HeatmapBand {
+	bands := make([]HeatmapBand, 0, len(boundaries)+1)
+	min := 0
+	for i := range boundaries {
+		max := boundaries[i]
+		bands = append(bands, HeatmapBand{MinAltitude: min, MaxAltitude: &max})
+		min = max
+	}
+	return append(bands, HeatmapBand{MinAltitude: min})
+}
+
+func (hm *Heatmap) add(lat, lng float64, alt int, weight float64) {
+	sw, ne := hm.Bounds.SouthWest, hm.Bounds.NorthEast
+	if lat < sw.Latitude || lat > ne.Latitude {
+		return
+	}
+
+	col := -1
+	for _, part := range hm.parts {
+		west, east := part.rect.SouthWest.Longitude, part.rect.NorthEast.Longitude
+		if lng < west || lng > east {
+			continue
+		}
+		col = part.col + int((lng-west)/hm.Resolution)
+		// points on the east edge belong to the last cells
+		if col == part.col+part.cols {
+			col--
+		}
+		break
+	}
+	if col < 0 {
+		return
+	}
+
+	row := int((lat - sw.Latitude) / hm.Resolution)
+	// points on the north edge belong to the last cells
+	if row == hm.Rows {
+		row--
+	}
+
+	band := len(hm.Bands) - 1
+	for b, hb := range hm.Bands {
+		if hb.MaxAltitude != nil && alt < *hb.MaxAltitude {
+			band = b
+			break
+		}
+	}
+
+	hm.Grids[band][row][col] += weight
+	hm.Total += weight
+}
+
+// GeoJSON represents non-empty cells as polygon features
+func (hm *Heatmap) GeoJSON() *GeoJSONFeatureCollection {
+	fc := newFeatureCollection()
+	for b, grid := range hm.Grids {
+		band := hm.Bands[b]
+		for r, row := range grid {
+			for c, count := range row {
+				if count == 0 {
+					continue
+				}
+				cell := hm.cell(r, c)
+				props := map[string]interface{}{
+					"count":   count,
+					"min_alt": band.MinAltitude,
+				}
+				if band.MaxAltitude != nil {
+					props["max_alt"] = *band.MaxAltitude
+				}
+				fc.Features = append(fc.Features, GeoJSONFeature{
+					Type:       "Feature",
+					Geometry:   rectPolygon(cell),
+					Properties: props,
+				})
+			}
+		}
+	}
+	return fc
+}
+
+// cell returns the rect of a grid cell cut by the bounds
+func (hm *Heatmap) cell(row, col int) geoidx.Rect {
+	sw, ne := hm.Bounds.SouthWest, hm.Bounds.NorthEast
+	part := hm.parts[len(hm.parts)-1]
+	for _, p := range hm.parts {
+		if col < p.col+p.cols {
+			part = p
+			break
+		}
+	}
+	west := part.rect.SouthWest.Longitude
+	return geoidx.MakeRect(
+		west+float64(col-part.col)*hm.Resolution,
+		sw.Latitude+float64(row)*hm.Resolution,
+		math.Min(west+float64(col-part.col+1)*hm.Resolution, part.rect.NorthEast.Longitude),
+		math.Min(sw.Latitude+float64(row+1)*hm.Resolution, ne.Latitude),
+	)
+}
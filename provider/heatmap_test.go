@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+func TestValidateHeatmapQuery(t *testing.T) {
+	p := &Provider{hcfg: config.HeatmapConfig{MaxCells: 100000, MaxHours: 24}}
+	europe := geoidx.MakeRect(-10, 35, 30, 60)
+
+	tests := []struct {
+		name  string
+		query HeatmapQuery
+		valid bool
+	}{
+		{"valid", HeatmapQuery{Bounds: europe, Resolution: 1}, true},
+		{"tiny resolution", HeatmapQuery{Bounds: europe, Resolution: 1e-300}, false},
+		{"denormal resolution", HeatmapQuery{Bounds: europe, Resolution: math.SmallestNonzeroFloat64}, false},
+		{"nan resolution", HeatmapQuery{Bounds: europe, Resolution: math.NaN()}, false},
+		{"inf resolution", HeatmapQuery{Bounds: europe, Resolution: math.Inf(1)}, false},
+		{"zero resolution", HeatmapQuery{Bounds: europe, Resolution: 0}, false},
+		{"huge bounds", HeatmapQuery{Bounds: geoidx.MakeRect(-1e308, -1e308, 1e308, 1e308), Resolution: 1}, false},
+		{"inf bounds", HeatmapQuery{Bounds: geoidx.MakeRect(math.Inf(-1), 35, 30, 60), Resolution: 1}, false},
+		{"nan bounds", HeatmapQuery{Bounds: geoidx.MakeRect(-10, math.NaN(), 30, 60), Resolution: 1}, false},
+		{"crossing the antimeridian", HeatmapQuery{Bounds: geoidx.MakeRect(170, -50, -170, -30), Resolution: 1}, true},
+		{"latitude out of range", HeatmapQuery{Bounds: geoidx.MakeRect(-10, 35, 30, 95), Resolution: 1}, false},
+		{"empty bounds", HeatmapQuery{Bounds: geoidx.MakeRect(10, 35, 10, 60), Resolution: 1}, false},
+		{"nan hours", HeatmapQuery{Bounds: europe, Resolution: 1, Hours: math.NaN()}, false},
+		{"too many bands", HeatmapQuery{Bounds: europe, Resolution: 0.01, AltitudeBands: []int{10000, 20000}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateHeatmapQuery(tt.query)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidHeatmap) {
+				t.Fatalf("expected ErrInvalidHeatmap, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHeatmapGrid(t *testing.T) {
+	p := &Provider{hcfg: config.HeatmapConfig{MaxCells: 100000, MaxHours: 24}}
+	hm, err := p.newHeatmap(HeatmapQuery{
+		Bounds:        geoidx.MakeRect(-10, 35, 30, 60),
+		Resolution:    1,
+		AltitudeBands: []int{10000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hm.Rows != 25 || hm.Cols != 40 || len(hm.Grids) != 2 {
+		t.Fatalf("unexpected grid %dx%dx%d", hm.Rows, hm.Cols, len(hm.Grids))
+	}
+
+	// north east corner belongs to the last cell
+	hm.add(60, 30, 35000, 1)
+	hm.add(35, -10, 5000, 1)
+	if hm.Grids[1][24][39] != 1 || hm.Grids[0][0][0] != 1 || hm.Total != 2 {
+		t.Fatal("points counted in wrong cells")
+	}
+}
+
+func TestHeatmapAntimeridian(t *testing.T) {
+	p := &Provider{hcfg: config.HeatmapConfig{MaxCells: 100000, MaxHours: 24}}
+	hm, err := p.newHeatmap(HeatmapQuery{
+		Bounds:     geoidx.MakeRect(170.5, -10, -170, 10),
+		Resolution: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9.5 degrees west of the antimeridian make 10 columns
+	if hm.Rows != 20 || hm.Cols != 20 {
+		t.Fatalf("unexpected grid %dx%d", hm.Rows, hm.Cols)
+	}
+
+	hm.add(0, 171, 35000, 1)
+	hm.add(0, 180, 35000, 1)
+	hm.add(0, -175, 35000, 1)
+	hm.add(0, 0, 35000, 1)
+	grid := hm.Grids[0][10]
+	if grid[0] != 1 || grid[9] != 1 || grid[15] != 1 || hm.Total != 3 {
+		t.Fatalf("points counted in wrong cells: %v", grid)
+	}
+
+	if cell := hm.cell(10, 9); cell != geoidx.MakeRect(179.5, 0, 180, 1) {
+		t.Fatalf("unexpected west cell %v", cell)
+	}
+	if cell := hm.cell(10, 15); cell != geoidx.MakeRect(-175, 0, -174, 1) {
+		t.Fatalf("unexpected east cell %v", cell)
+	}
+}
+
+// equatorFlight samples a flight along the equator every period seconds
+func equatorFlight(from, count int, lng float64, period int64, gs int) []track.TrackPoint {
+	points := make([]track.TrackPoint, count)
+	for i := range points {
+		points[i] = track.TrackPoint{
+			Longitude:   lng + float64(gs)/3600*float64(period)*float64(i)/60,
+			Altitude:    35000,
+			Groundspeed: gs,
+			TimeStamp:   int64(from) + period*int64(i),
+		}
+	}
+	return points
+}
+
+func TestSampleTrackCompressed(t *testing.T) {
+	const period = 15
+	gap := trackGap{maxGap: track.MaxCompressedGap(period * time.Second), toleranceNM: 0.5}
+
+	// parked for two hours, then flying straight, the track is
+	// left with gaps longer than heatmapMaxPointGap
+	points := equatorFlight(1600000000, 480, 0, period, 0)
+	last := points[len(points)-1]
+	points = append(points, equatorFlight(int(last.TimeStamp)+period, 200, 0, period, 450)...)
+
+	c := track.NewCompressor(0.5)
+	stored := make([]track.TrackPoint, 0)
+	for _, point := range points {
+		switch c.Compress("AAA1", stored, point) {
+		case track.ActionAppend:
+			stored = append(stored, point)
+		case track.ActionReplaceLast:
+			stored[len(stored)-1] = point
+		}
+	}
+	if len(stored) > 6 {
+		t.Fatalf("expected the track to be compressed, got %d points", len(stored))
+	}
+
+	from, to := points[0].TimeStamp, points[len(points)-1].TimeStamp
+	count := 0
+	sampleTrack(stored, from, to, 60, gap, func(lat, lng float64, alt int) {
+		count++
+	})
+	if expected := int((to-from)/60) + 1; count != expected {
+		t.Fatalf("expected %d samples, got %d", expected, count)
+	}
+
+	// a disconnect between two distinct points is not interpolated
+	disconnected := []track.TrackPoint{points[len(points)-2], points[len(points)-1]}
+	disconnected[1].TimeStamp = disconnected[0].TimeStamp + 60*(int64(gap.maxGap.Minutes())+2)
+	count = 0
+	sampleTrack(disconnected, disconnected[0].TimeStamp, disconnected[1].TimeStamp, 60, gap, func(lat, lng float64, alt int) {
+		count++
+	})
+	if count != 1 {
+		t.Fatalf("expected only the sample at the latest point, got %d", count)
+	}
+}
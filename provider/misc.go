@@ -1,9 +1,8 @@
 package provider
 
 import (
-	"math"
-
 	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch/geo"
 )
 
 const (
@@ -11,33 +10,24 @@ const (
 	planeSizeNM   = 0.005
 )
 
-func nmToLatLon(latSizeNM float64, lngSizeNM float64, atLatitude float64) (lng float64, lat float64) {
-	// for latitude 60nm is 1˚
-	lat = (1.0 / 60) * latSizeNM
-
-	// for longitude it depends on current latitude
-	// first let's convert latitude degree to radians
-	latitudeRad := (atLatitude * 2 * math.Pi) / 360
-
-	// calculate size
-	lng = (1.0 / 60) * lngSizeNM
-	// and make a latitude correction
-	lng = lng / math.Abs(math.Cos(latitudeRad))
-	return
-}
-
-// square makes square bounds of a given size
-// Lat and Lng represent top left angle of the square
-func square(lat float64, lng float64, sizeNM float64) geoidx.Rect {
-	lngSize, latSize := nmToLatLon(sizeNM, sizeNM, lat)
-	return geoidx.MakeRect(lng, lat, lng+lngSize, lat+latSize)
-}
-
-// squareCentered makes square bounds of a given size
-// Lat and Lng represent center of the square
-func squareCentered(lat float64, lng float64, sizeNM float64) geoidx.Rect {
-	lngSize, latSize := nmToLatLon(sizeNM/2, sizeNM/2, lat)
-	lat = lat - latSize
-	lng = lng - lngSize
-	return square(lat, lng, sizeNM)
+// searchAround finds objects within the bounding box of a circle
+// around a point, callers are expected to check actual distances
+func (p *Provider) searchAround(lat float64, lng float64, radiusNM float64, filters ...geoidx.Filter) []*geoidx.Object {
+	rects := geo.SplitRect(geo.BoundingBox(lat, lng, radiusNM))
+	if len(rects) == 1 {
+		return p.idx.SearchByRect(rects[0], filters...)
+	}
+
+	// an object crossing the antimeridian may be found in both rects
+	seen := make(map[string]bool)
+	objects := make([]*geoidx.Object, 0)
+	for _, rect := range rects {
+		for _, obj := range p.idx.SearchByRect(rect, filters...) {
+			if !seen[obj.ID()] {
+				seen[obj.ID()] = true
+				objects = append(objects, obj)
+			}
+		}
+	}
+	return objects
 }
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+)
+
+var (
+	facilityNames = map[vatsimapi.Facility]string{
+		vatsimapi.FacilityATIS:     "atis",
+		vatsimapi.FacilityDelivery: "delivery",
+		vatsimapi.FacilityGround:   "ground",
+		vatsimapi.FacilityTower:    "tower",
+		vatsimapi.FacilityApproach: "approach",
+		vatsimapi.FacilityRadar:    "radar",
+	}
+)
+
+// NetworkCounts is what's online at the moment, controllers are
+// counted by facility name and pilots by aircraft type designator
+type NetworkCounts struct {
+	Pilots        int
+	Controllers   map[string]int
+	AircraftTypes map[string]int
+}
+
+// FacilityNames lists controller facility names used by NetworkCounts
+func FacilityNames() []string {
+	names := make([]string, 0, len(facilityNames))
+	for f := vatsimapi.FacilityATIS; f <= vatsimapi.FacilityRadar; f++ {
+		names = append(names, facilityNames[vatsimapi.Facility(f)])
+	}
+	return names
+}
+
+func (p *Provider) NetworkCounts() NetworkCounts {
+	nc := NetworkCounts{
+		Controllers:   make(map[string]int),
+		AircraftTypes: make(map[string]int),
+	}
+
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+
+	nc.Pilots = len(p.pilots)
+	for _, pilot := range p.pilots {
+		if tp := aircraftDesignator(pilot); tp != "" {
+			nc.AircraftTypes[tp]++
+		}
+	}
+
+	// a controller may show up at several airports
+	seen := make(map[string]bool)
+	count := func(ctrl *vatsimapi.Controller) {
+		if ctrl == nil || seen[ctrl.Callsign] {
+			return
+		}
+		seen[ctrl.Callsign] = true
+		if name, found := facilityNames[ctrl.Facility]; found {
+			nc.Controllers[name]++
+		}
+	}
+	for _, arpt := range p.airports {
+		count(arpt.Controllers.ATIS)
+		count(arpt.Controllers.Delivery)
+		count(arpt.Controllers.Ground)
+		count(arpt.Controllers.Tower)
+		count(arpt.Controllers.Approach)
+	}
+	for _, radar := range p.radars {
+		count(&radar.Controller)
+	}
+	return nc
+}
+
+// aircraftDesignator prefers the known aircraft type and falls back to
+// the filed one, both "B738/M" and "H/B744/L" forms are understood
+func aircraftDesignator(pilot *merged.Pilot) string {
+	if pilot.AircraftType != nil {
+		return pilot.AircraftType.Designator
+	}
+	if pilot.FlightPlan == nil {
+		return ""
+	}
+	for _, token := range strings.Split(pilot.FlightPlan.Aircraft, "/") {
+		// wake turbulence and equipment codes are single letters
+		if token = strings.TrimSpace(token); len(token) > 1 {
+			return strings.ToUpper(token)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"math"
+	"sync"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+// polygon is a boundary ring with longitudes unwrapped so that rings
+// crossing the antimeridian stay continuous, i.e. 170..190 rather than
+// jumping from 179 to -179. Points are [lng, lat].
+type polygon struct {
+	points [][2]float64
+	min    [2]float64
+	max    [2]float64
+}
+
+// firGeometryCache keeps FIR polygons built from vatspy boundaries,
+// boundaries rarely change so polygons are rebuilt only when
+// the boundaries bounding box does
+type firGeometryCache struct {
+	entries map[string]*firGeometry
+	lock    sync.Mutex
+}
+
+type firGeometry struct {
+	min      vatspydata.Point
+	max      vatspydata.Point
+	polygons []*polygon
+}
+
+func newFIRGeometryCache() *firGeometryCache {
+	return &firGeometryCache{entries: make(map[string]*firGeometry)}
+}
+
+func (c *firGeometryCache) get(fir vatspydata.FIR) []*polygon {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	bnds := fir.Boundaries
+	geom, found := c.entries[fir.ID]
+	if !found || geom.min != bnds.Min || geom.max != bnds.Max {
+		geom = &firGeometry{min: bnds.Min, max: bnds.Max}
+		for _, ring := range bnds.Points {
+			if pg := newPolygon(ring); pg != nil {
+				geom.polygons = append(geom.polygons, pg)
+			}
+		}
+		c.entries[fir.ID] = geom
+	}
+	return geom.polygons
+}
+
+func newPolygon(ring []vatspydata.Point) *polygon {
+	if len(ring) < 3 {
+		return nil
+	}
+
+	pg := &polygon{points: make([][2]float64, len(ring))}
+	prev := ring[0].Lng
+	for i, pt := range ring {
+		lng := pt.Lng
+		for lng-prev > 180 {
+			lng -= 360
+		}
+		for lng-prev < -180 {
+			lng += 360
+		}
+		pg.points[i] = [2]float64{lng, pt.Lat}
+		prev = lng
+	}
+
+	pg.min = pg.points[0]
+	pg.max = pg.points[0]
+	for _, pt := range pg.points[1:] {
+		pg.min[0] = math.Min(pg.min[0], pt[0])
+		pg.min[1] = math.Min(pg.min[1], pt[1])
+		pg.max[0] = math.Max(pg.max[0], pt[0])
+		pg.max[1] = math.Max(pg.max[1], pt[1])
+	}
+	return pg
+}
+
+func (pg *polygon) crossesAntimeridian() bool {
+	return pg.min[0] < -180 || pg.max[0] > 180
+}
+
+// contains is an even-odd rule ray casting test
+func (pg *polygon) contains(lat float64, lng float64) bool {
+	for _, shift := range []float64{0, 360, -360} {
+		if pg.containsUnwrapped(lat, lng+shift) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pg *polygon) containsUnwrapped(lat float64, lng float64) bool {
+	if lng < pg.min[0] || lng > pg.max[0] || lat < pg.min[1] || lat > pg.max[1] {
+		return false
+	}
+
+	inside := false
+	pts := pg.points
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		a, b := pts[i], pts[j]
+		if (a[1] > lat) != (b[1] > lat) &&
+			lng < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// intersects checks whether the polygon and the rect share any point,
+// rects crossing the antimeridian have SW longitude greater than NE one
+func (pg *polygon) intersects(rect geoidx.Rect) bool {
+	for _, r := range geo.SplitRect(rect) {
+		for _, shift := range []float64{0, 360, -360} {
+			if pg.intersectsUnwrapped(
+				r.SouthWest.Longitude+shift, r.SouthWest.Latitude,
+				r.NorthEast.Longitude+shift, r.NorthEast.Latitude,
+			) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (pg *polygon) intersectsUnwrapped(minLng, minLat, maxLng, maxLat float64) bool {
+	if maxLng < pg.min[0] || minLng > pg.max[0] || maxLat < pg.min[1] || minLat > pg.max[1] {
+		return false
+	}
+
+	// a polygon vertex within the rect
+	for _, pt := range pg.points {
+		if pt[0] >= minLng && pt[0] <= maxLng && pt[1] >= minLat && pt[1] <= maxLat {
+			return true
+		}
+	}
+
+	// the rect within the polygon
+	if pg.containsUnwrapped(minLat, minLng) {
+		return true
+	}
+
+	// edges crossing each other
+	corners := [4][2]float64{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}}
+	pts := pg.points
+	for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+		for k := 0; k < 4; k++ {
+			if segmentsIntersect(pts[j], pts[i], corners[k], corners[(k+1)%4]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentsIntersect(p1, p2, q1, q2 [2]float64) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+func orientation(a, b, c [2]float64) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// polygonsBounds is an index rect of polygons, the whole longitude
+// range if any of them crosses the antimeridian as the index can't
+// store a rect wrapping around
+func polygonsBounds(polygons []*polygon) (geoidx.Rect, bool) {
+	if len(polygons) == 0 {
+		return geoidx.Rect{}, false
+	}
+
+	min := polygons[0].min
+	max := polygons[0].max
+	crosses := false
+	for _, pg := range polygons {
+		min[0] = math.Min(min[0], pg.min[0])
+		min[1] = math.Min(min[1], pg.min[1])
+		max[0] = math.Max(max[0], pg.max[0])
+		max[1] = math.Max(max[1], pg.max[1])
+		crosses = crosses || pg.crossesAntimeridian()
+	}
+	if crosses {
+		min[0], max[0] = -180, 180
+	}
+	return geoidx.MakeRect(min[0], min[1], max[0], max[1]), true
+}
+
+// radarPolygons collects polygons of all FIRs covered by a radar
+func (p *Provider) radarPolygons(radar *merged.Radar) []*polygon {
+	polygons := make([]*polygon, 0)
+	for _, fir := range radar.FIRs {
+		polygons = append(polygons, p.firGeoms.get(fir)...)
+	}
+	return polygons
+}
+
+// radarIntersects is true for radars whose FIR polygons intersect
+// the rect, radars without boundaries are left to the index rect
+func (p *Provider) radarIntersects(radar *merged.Radar, rect geoidx.Rect) bool {
+	polygons := p.radarPolygons(radar)
+	if len(polygons) == 0 {
+		return true
+	}
+	for _, pg := range polygons {
+		if pg.intersects(rect) {
+			return true
+		}
+	}
+	return false
+}
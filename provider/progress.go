@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const (
+	// with 15s vatsim polls it's about two minutes of flight
+	gsHistorySize = 8
+)
+
+var (
+	durationLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?[hms](?:\d+(?:\.\d+)?[hms])*\b`)
+)
+
+// Progress is a pilot's progress towards the flight plan arrival airport
+type Progress struct {
+	DistanceToGo float64    `json:"dtg"`
+	ETA          *time.Time `json:"eta,omitempty"`
+}
+
+// GetProgress returns the progress of a pilot with a flight plan to a known airport
+func (p *Provider) GetProgress(callsign string) (*Progress, bool) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	return p.progressUnsafe(callsign)
+}
+
+func (p *Provider) progressUnsafe(callsign string) (*Progress, bool) {
+	prog, found := p.progress[callsign]
+	return prog, found
+}
+
+// updateProgressUnsafe records the pilot's groundspeed sample and
+// recalculates its progress, must be called with dataLock held
+func (p *Provider) updateProgressUnsafe(pilot *merged.Pilot, now time.Time) {
+	history := p.gsHistory[pilot.Callsign]
+	if track.IsOnGround(pilot) {
+		// taxi speeds say nothing about the flight
+		history = history[:0]
+	} else {
+		p.airborne[pilot.Callsign] = true
+		if len(history) == gsHistorySize {
+			copy(history, history[1:])
+			history = history[:gsHistorySize-1]
+		}
+		history = append(history, pilot.Groundspeed)
+	}
+	p.gsHistory[pilot.Callsign] = history
+
+	var arr *merged.Airport
+	if pilot.FlightPlan != nil {
+		arr = p.airports[pilot.FlightPlan.Arrival]
+	}
+	if arr == nil {
+		delete(p.progress, pilot.Callsign)
+		return
+	}
+	p.progress[pilot.Callsign] = flightProgress(pilot, arr, history, now)
+}
+
+func (p *Provider) forgetProgressUnsafe(callsign string) {
+	delete(p.gsHistory, callsign)
+	delete(p.progress, callsign)
+	delete(p.airborne, callsign)
+}
+
+// seedProgress restores groundspeed histories and airborne states of
+// pilots known at the initial sync from their stored tracks, so they
+// don't start from scratch after a restart
+func (p *Provider) seedProgress() {
+	l := log.WithField("func", "seedProgress")
+
+	p.dataLock.RLock()
+	pilots := make([]*merged.Pilot, 0, len(p.pilots))
+	for _, pilot := range p.pilots {
+		pilots = append(pilots, pilot)
+	}
+	p.dataLock.RUnlock()
+
+	seeded := 0
+	for _, pilot := range pilots {
+		tr, err := track.LoadTrack(context.Background(), pilot)
+		if err != nil {
+			l.WithField("callsign", pilot.Callsign).WithError(err).Trace("no stored track")
+			continue
+		}
+		history, airborne := trackGSHistory(tr.Points)
+
+		p.dataLock.Lock()
+		if airborne {
+			p.airborne[pilot.Callsign] = true
+			// the stored track ends with the live samples taken so far
+			if len(history) > len(p.gsHistory[pilot.Callsign]) {
+				p.gsHistory[pilot.Callsign] = history
+			}
+			seeded++
+		}
+		p.dataLock.Unlock()
+	}
+	l.WithField("pilots", seeded).Debug("progress seeded from stored tracks")
+}
+
+// trackGSHistory returns groundspeeds of the trailing airborne
+// points of a track the way updateProgressUnsafe collects them,
+// and whether the aircraft has been in the air at all
+func trackGSHistory(points []track.TrackPoint) ([]int, bool) {
+	start := len(points)
+	for start > 0 && !points[start-1].OnGround {
+		start--
+	}
+	if len(points)-start > gsHistorySize {
+		start = len(points) - gsHistorySize
+	}
+	history := make([]int, 0, gsHistorySize)
+	for _, point := range points[start:] {
+		history = append(history, point.Groundspeed)
+	}
+
+	airborne := len(history) > 0
+	for i := 0; i < start && !airborne; i++ {
+		airborne = !points[i].OnGround
+	}
+	return history, airborne
+}
+
+// flightProgress calculates the distance to go and the estimated arrival
+// time. Airborne flights use their recent average groundspeed, the rest
+// use the filed cruise speed, ETA is missing if neither is known.
+func flightProgress(pilot *merged.Pilot, arr *merged.Airport, gsHistory []int, now time.Time) *Progress {
+	prog := &Progress{DistanceToGo: distanceToAirport(pilot, arr)}
+
+	speed := 0
+	if len(gsHistory) > 0 {
+		for _, gs := range gsHistory {
+			speed += gs
+		}
+		speed /= len(gsHistory)
+	} else if pilot.FlightPlan != nil {
+		speed = parseCruiseSpeed(pilot.FlightPlan.CruiseTas)
+	}
+	if speed <= 0 {
+		return prog
+	}
+
+	eta := now.Add(time.Duration(prog.DistanceToGo / float64(speed) * float64(time.Hour))).Truncate(time.Second)
+	prog.ETA = &eta
+	return prog
+}
+
+func distanceToAirport(pilot *merged.Pilot, arpt *merged.Airport) float64 {
+	return geo.DistanceNM(pilot.Latitude, pilot.Longitude, arpt.Meta.Position.Lat, arpt.Meta.Position.Lng)
+}
+
+// parseCruiseSpeed understands plain knots as well as "N0450"
+// and mach "M079" forms
+func parseCruiseSpeed(tas string) int {
+	tas = strings.ToUpper(strings.TrimSpace(tas))
+	if tas == "" {
+		return 0
+	}
+
+	switch tas[0] {
+	case 'N', 'K':
+		tas = tas[1:]
+	case 'M':
+		mach, err := strconv.Atoi(tas[1:])
+		if err != nil {
+			return 0
+		}
+		// roughly 573 knots per mach at cruise levels
+		return mach * 573 / 100
+	}
+
+	speed, err := strconv.Atoi(tas)
+	if err != nil {
+		return 0
+	}
+	return speed
+}
+
+// normalizeDurations replaces duration literals like 30m or 1h30m outside
+// of string literals with a number of minutes, lee doesn't know durations
+func normalizeDurations(query string) string {
+	var sb strings.Builder
+	var quote rune
+	start := 0
+
+	flush := func(end int) {
+		sb.WriteString(durationLiteral.ReplaceAllStringFunc(query[start:end], func(lit string) string {
+			d, err := time.ParseDuration(lit)
+			if err != nil {
+				return lit
+			}
+			return strconv.FormatFloat(d.Minutes(), 'f', -1, 64)
+		}))
+	}
+
+	escaped := false
+	for i, r := range query {
+		if quote != 0 {
+			if r == quote && !escaped {
+				sb.WriteString(query[start : i+1])
+				start = i + 1
+				quote = 0
+			}
+			escaped = r == '\\'
+			continue
+		}
+		if r == '"' || r == '\'' {
+			flush(i)
+			start = i
+			quote = r
+		}
+	}
+	if quote != 0 {
+		// unterminated string, leave it to the lexer to complain
+		sb.WriteString(query[start:])
+	} else {
+		flush(len(query))
+	}
+	return sb.String()
+}
+
+func minutesTo(t time.Time) float64 {
+	return time.Until(t).Minutes()
+}
+
+func errProgressUnavailable(field string) error {
+	return fmt.Errorf("%s filter is not available here", field)
+}
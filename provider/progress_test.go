@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+func TestTrackGSHistory(t *testing.T) {
+	points := func(samples ...int) []track.TrackPoint {
+		list := make([]track.TrackPoint, len(samples))
+		for i, gs := range samples {
+			// negative speeds mark samples on the ground
+			list[i] = track.TrackPoint{Groundspeed: gs, OnGround: gs < 0, TimeStamp: int64(1600000000 + i*15)}
+			if gs < 0 {
+				list[i].Groundspeed = -gs
+			}
+		}
+		return list
+	}
+
+	tcs := []struct {
+		name     string
+		points   []track.TrackPoint
+		history  []int
+		airborne bool
+	}{
+		{"no track", nil, []int{}, false},
+		{"taxiing", points(-5, -15, -20), []int{}, false},
+		{"climbing", points(-15, 150, 200, 250), []int{150, 200, 250}, true},
+		{"cruising", points(-15, 200, 300, 400, 440, 450, 450, 450, 450, 460, 470), []int{400, 440, 450, 450, 450, 450, 460, 470}, true},
+		{"landed", points(-15, 450, 250, 150, -60, -20), []int{}, true},
+		{"touch and go", points(-15, 150, -130, 140, 160), []int{140, 160}, true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			history, airborne := trackGSHistory(tc.points)
+			if !reflect.DeepEqual(history, tc.history) || airborne != tc.airborne {
+				t.Fatalf("expected %v (airborne %v), got %v (airborne %v)", tc.history, tc.airborne, history, airborne)
+			}
+		})
+	}
+}
@@ -10,7 +10,10 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/geoidx"
 	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
 	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/recorder"
 	"github.com/vatsimnerd/simwatch/track"
 	"github.com/vatsimnerd/util/pubsub"
 	"github.com/vatsimnerd/util/set"
@@ -23,62 +26,172 @@ var (
 )
 
 type Provider struct {
-	vatsim *merged.Provider
-	stop   chan bool
-	idx    *geoidx.Index
-	tcfg   config.TrackConfig
+	src  Source
+	stop chan bool
+	idx  *geoidx.Index
+	tcfg config.TrackConfig
+	scfg config.SnapshotConfig
+	hcfg config.HeatmapConfig
+	// srcPeriod is the time between source data cycles
+	srcPeriod time.Duration
+
+	trackWriter *track.Writer
+	recorder    *recorder.Recorder
+	events      *EventBus
+	// started is when Start was called, stored track points
+	// older than that are history
+	started time.Time
+	// synced is set after the first full data cycle, objects
+	// appearing before that aren't reported as events
+	synced bool
+	// stale keeps objects restored from a snapshot which
+	// the source hasn't confirmed yet
+	stale map[staleKey]bool
+	fresh *freshness
+
+	conflicts *conflictDetector
+	runways   *runwayTracker
+	firs      *firCatalog
+	firGeoms  *firGeometryCache
+	routes    *routeCache
+	// dataCfg is set when static FIR data is to be loaded
+	dataCfg *vatspydata.Config
+
+	// cycle is closed and replaced at the end of every data cycle
+	cycle     chan struct{}
+	cycleLock sync.Mutex
+
+	snapStop chan struct{}
+	snapDone chan struct{}
 
 	airports map[string]*merged.Airport
 	pilots   map[string]*merged.Pilot
 	radars   map[string]*merged.Radar
+	// progress is kept for pilots with flight plans to known airports
+	progress  map[string]*Progress
+	gsHistory map[string][]int
+	// airborne holds pilots seen in the air since they connected
+	airborne map[string]bool
 
 	airportTrace *set.SafeSet[string]
 
 	dataLock sync.RWMutex
 }
 
-func New(cfg *config.Config) *Provider {
-	return &Provider{
-		vatsim: merged.New(&cfg.API, &cfg.Data, &cfg.Runways),
-		stop:   make(chan bool),
-		idx:    geoidx.NewIndex(),
-		tcfg:   cfg.Track,
+func New(cfg *config.Config) (*Provider, error) {
+	src, err := newSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := NewWithSource(cfg, src)
+	p.dataCfg = &cfg.Data
+	return p, nil
+}
+
+// NewWithSource creates a provider fed by a custom source,
+// cfg.Source is ignored and static FIR data isn't loaded
+func NewWithSource(cfg *config.Config, src Source) *Provider {
+	p := &Provider{
+		src:  src,
+		stop: make(chan bool),
+		idx:  geoidx.NewIndex(),
+		tcfg: cfg.Track,
+		scfg: cfg.Snapshot,
+		hcfg: cfg.Heatmap,
+
+		srcPeriod: sourcePeriod(cfg),
+
+		trackWriter: track.NewWriter(cfg.Track.Options.QueueSize, cfg.Track.Options.WriteTimeout),
+		events:      NewEventBus(),
+		stale:       make(map[staleKey]bool),
+		cycle:       make(chan struct{}),
+		conflicts:   newConflictDetector(cfg.Conflicts),
+		runways:     newRunwayTracker(cfg.ActiveRunways),
+		firs:        newFIRCatalog(),
+		firGeoms:    newFIRGeometryCache(),
+		fresh:       newFreshness(time.Duration(cfg.Freshness.StalePolls) * sourcePeriod(cfg)),
 
 		airports: make(map[string]*merged.Airport),
 		pilots:   make(map[string]*merged.Pilot),
 		radars:   make(map[string]*merged.Radar),
 
+		progress:  make(map[string]*Progress),
+		gsHistory: make(map[string][]int),
+		airborne:  make(map[string]bool),
+
 		airportTrace: set.NewSafe[string](),
 	}
+
+	p.routes = newRouteCache(cfg.Routes, p.airportPosition)
+
+	if cfg.Recorder.Enabled {
+		p.recorder = recorder.New(cfg.Recorder)
+	}
+	return p
 }
 
 func (p *Provider) Start() error {
+	p.started = time.Now()
 	err := p.setupTrackStore()
 	if err != nil {
 		return err
 	}
+	p.trackWriter.Start()
+
+	if p.recorder != nil {
+		err = p.recorder.Start()
+		if err != nil {
+			return err
+		}
+	}
 
-	err = p.vatsim.Start()
+	if p.scfg.Enabled {
+		err = p.restoreSnapshot()
+		if err != nil {
+			// a broken snapshot is not a reason to refuse starting
+			log.WithError(err).Error("error restoring snapshot, starting cold")
+		}
+	}
+
+	err = p.src.Start()
 	if err != nil {
 		return err
 	}
 	go p.loop()
+
+	if p.dataCfg != nil {
+		go p.firs.load(p.dataCfg)
+	}
+
+	if p.scfg.Enabled && p.scfg.Interval > 0 {
+		p.snapStop = make(chan struct{})
+		p.snapDone = make(chan struct{})
+		go p.snapshotLoop(p.snapStop, p.snapDone)
+	}
 	return nil
 }
 
 func (p *Provider) Stop() {
 	p.stop <- true
+	close(p.firs.stop)
+	if p.snapStop != nil {
+		close(p.snapStop)
+		<-p.snapDone
+	}
+	p.trackWriter.Stop()
 	track.Close()
+	if p.recorder != nil {
+		p.recorder.Stop()
+	}
 }
 
 func (p *Provider) loop() {
 	l := log.WithField("func", "loop")
-	var err error
 
-	defer p.vatsim.Stop()
+	defer p.src.Stop()
 
-	s := p.vatsim.Subscribe(32768)
-	defer p.vatsim.Unsubscribe(s)
+	s := p.src.Subscribe(32768)
+	defer p.src.Unsubscribe(s)
 
 	count := 0
 
@@ -87,32 +200,19 @@ func (p *Provider) loop() {
 		case upd := <-s.Updates():
 			count++
 			if count%1000 == 0 {
-				l.Debugf("accumulated %d updates from merged provider", count)
+				l.Debugf("accumulated %d updates from source", count)
 			}
-			switch upd.UType {
-			case pubsub.UpdateTypeSet:
-				switch upd.OType {
-				case merged.ObjectTypeAirport:
-					err = p.setAirport(upd.Obj)
-				case merged.ObjectTypePilot:
-					err = p.setPilot(upd.Obj)
-				case merged.ObjectTypeRadar:
-					err = p.setRadar(upd.Obj)
-				}
-			case pubsub.UpdateTypeDelete:
-				switch upd.OType {
-				case merged.ObjectTypeAirport:
-					err = p.deleteAirport(upd.Obj)
-				case merged.ObjectTypePilot:
-					err = p.deletePilot(upd.Obj)
-				case merged.ObjectTypeRadar:
-					err = p.deleteRadar(upd.Obj)
+			if p.recorder != nil {
+				if upd.UType == pubsub.UpdateTypeFin {
+					p.recorder.Commit()
+				} else {
+					p.recorder.Add(upd)
 				}
 			}
 
+			err := p.applyUpdate(upd)
 			if err != nil {
-				l.WithField("upd", upd).WithError(err).Error("error deleting object")
-				err = nil
+				l.WithField("upd", upd).WithError(err).Error("error applying update")
 			}
 
 		case <-p.stop:
@@ -121,6 +221,52 @@ func (p *Provider) loop() {
 	}
 }
 
+// applyUpdate brings provider state in line with a source update
+func (p *Provider) applyUpdate(upd pubsub.Update) error {
+	switch upd.UType {
+	case pubsub.UpdateTypeFin:
+		// sources send fin at the end of every data cycle,
+		// i.e. merged provider does it after every vatsim poll
+		p.trackWriter.Flush()
+		p.fresh.cycleComplete()
+		defer p.completeCycle()
+		if !p.synced {
+			p.reconcile()
+			p.seedProgress()
+			p.seedRunwayOps()
+			log.Info("initial data sync complete")
+			p.dataLock.Lock()
+			p.synced = true
+			p.dataLock.Unlock()
+		}
+		p.detectConflicts()
+		p.expireRunwayOps()
+	case pubsub.UpdateTypeSet:
+		// setters tell restored objects by their stale mark
+		defer p.markFresh(upd.Obj)
+		p.fresh.touch(upd.Obj)
+		switch upd.OType {
+		case merged.ObjectTypeAirport:
+			return p.setAirport(upd.Obj)
+		case merged.ObjectTypePilot:
+			return p.setPilot(upd.Obj)
+		case merged.ObjectTypeRadar:
+			return p.setRadar(upd.Obj)
+		}
+	case pubsub.UpdateTypeDelete:
+		p.fresh.forget(upd.Obj)
+		switch upd.OType {
+		case merged.ObjectTypeAirport:
+			return p.deleteAirport(upd.Obj)
+		case merged.ObjectTypePilot:
+			return p.deletePilot(upd.Obj)
+		case merged.ObjectTypeRadar:
+			return p.deleteRadar(upd.Obj)
+		}
+	}
+	return nil
+}
+
 func (p *Provider) setAirport(obj interface{}) error {
 	l := log.WithFields(logrus.Fields{
 		"func": "setAirport",
@@ -136,7 +282,7 @@ func (p *Provider) setAirport(obj interface{}) error {
 
 	iobj := geoidx.NewObject(
 		arpt.Meta.ICAO,
-		squareCentered(arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, airportSizeNM),
+		geo.ObjectBox(arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, airportSizeNM/2),
 		&arpt,
 	)
 
@@ -153,9 +299,21 @@ func (p *Provider) setAirport(obj interface{}) error {
 	} else {
 		l.Trace("inserting airport to index")
 	}
+	prev := p.airports[arpt.Meta.ICAO]
 	p.airports[arpt.Meta.ICAO] = &arpt
 	p.dataLock.Unlock()
 
+	srcPrev := prev
+	if p.stale[objectKey(arpt)] {
+		// the first source update of a restored airport is
+		// fresh data even if nothing has changed
+		srcPrev = nil
+	}
+	for _, src := range airportSources(srcPrev, &arpt) {
+		p.fresh.sourceUpdated(src)
+	}
+	p.detectAirportEvents(prev, &arpt)
+
 	return nil
 }
 
@@ -174,7 +332,7 @@ func (p *Provider) deleteAirport(obj interface{}) error {
 
 	iobj := geoidx.NewObject(
 		arpt.Meta.ICAO,
-		squareCentered(arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, airportSizeNM),
+		geo.ObjectBox(arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, airportSizeNM/2),
 		&arpt,
 	)
 	if trace {
@@ -182,7 +340,7 @@ func (p *Provider) deleteAirport(obj interface{}) error {
 	} else {
 		l.Trace("deleting airport geo object")
 	}
-	p.idx.Delete(iobj)
+	p.idx.Delete(p.indexedObject(iobj))
 
 	if trace {
 		l.Info("deleting airport from index")
@@ -190,9 +348,15 @@ func (p *Provider) deleteAirport(obj interface{}) error {
 		l.Trace("deleting airport from index")
 	}
 	p.dataLock.Lock()
+	prev := p.airports[arpt.Meta.ICAO]
 	delete(p.airports, arpt.Meta.ICAO)
 	p.dataLock.Unlock()
 
+	if prev != nil {
+		// controllers left with the airport
+		p.detectAirportEvents(prev, &merged.Airport{Meta: prev.Meta})
+	}
+
 	return nil
 }
 
@@ -207,9 +371,14 @@ func (p *Provider) setPilot(obj interface{}) error {
 		return fmt.Errorf("unexpected type %T, expected to be Pilot", obj)
 	}
 
+	// progress goes first as subscription filters may use it
+	p.dataLock.Lock()
+	p.updateProgressUnsafe(&pilot, time.Now())
+	p.dataLock.Unlock()
+
 	iobj := geoidx.NewObject(
 		pilot.Callsign,
-		squareCentered(pilot.Latitude, pilot.Longitude, planeSizeNM),
+		geo.ObjectBox(pilot.Latitude, pilot.Longitude, planeSizeNM/2),
 		&pilot,
 	)
 	l.Trace("upserting pilot geo object")
@@ -217,15 +386,21 @@ func (p *Provider) setPilot(obj interface{}) error {
 
 	l.Trace("inserting pilot to index")
 	p.dataLock.Lock()
+	prev := p.pilots[pilot.Callsign]
 	p.pilots[pilot.Callsign] = &pilot
 	p.dataLock.Unlock()
 
-	l.Trace("writing pilot's track")
+	if p.stale[objectKey(pilot)] {
+		// a restored position is too old to compare with
+		prev = nil
+	}
+	p.detectPilotEvents(prev, &pilot)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	err := track.WriteTrack(ctx, &pilot)
-	return err
+	l.Trace("queueing pilot's track point")
+	if !p.trackWriter.Push(&pilot) {
+		l.Debug("track writer queue is full, point dropped")
+	}
+	return nil
 }
 
 func (p *Provider) deletePilot(obj interface{}) error {
@@ -241,16 +416,22 @@ func (p *Provider) deletePilot(obj interface{}) error {
 
 	iobj := geoidx.NewObject(
 		pilot.Callsign,
-		squareCentered(pilot.Latitude, pilot.Longitude, planeSizeNM),
+		geo.ObjectBox(pilot.Latitude, pilot.Longitude, planeSizeNM/2),
 		&pilot,
 	)
 	l.Trace("deleting pilot geo object")
-	p.idx.Delete(iobj)
+	p.idx.Delete(p.indexedObject(iobj))
 
 	l.Trace("deleting pilot from index")
 	p.dataLock.Lock()
 	delete(p.pilots, pilot.Callsign)
+	p.forgetProgressUnsafe(pilot.Callsign)
 	p.dataLock.Unlock()
+	p.routes.forget(pilot.Callsign)
+
+	if p.synced {
+		p.events.Publish(Event{Type: EventPilotDisconnected, Callsign: pilot.Callsign, Pilot: &pilot})
+	}
 
 	return nil
 }
@@ -266,26 +447,32 @@ func (p *Provider) setRadar(obj interface{}) error {
 		return fmt.Errorf("unexpected type %T, expected to be Radar", obj)
 	}
 	l = l.WithField("callsign", radar.Controller.Callsign)
+	p.firs.learn(&radar)
 
-	minLng := 1000.0
-	minLat := 1000.0
-	maxLng := -1000.0
-	maxLat := -1000.0
-	for _, fir := range radar.FIRs {
-		if fir.Boundaries.Min.Lat < minLat {
-			minLat = fir.Boundaries.Min.Lat
-		}
-		if fir.Boundaries.Min.Lng < minLng {
-			minLng = fir.Boundaries.Min.Lng
-		}
-		if fir.Boundaries.Max.Lat > maxLat {
-			maxLat = fir.Boundaries.Max.Lat
-		}
-		if fir.Boundaries.Max.Lng > maxLng {
-			maxLng = fir.Boundaries.Max.Lng
+	// subscribers are matched against actual FIR polygons by
+	// radar filters, the rect only narrows the index search
+	rect, ok := polygonsBounds(p.radarPolygons(&radar))
+	if !ok {
+		minLng := 1000.0
+		minLat := 1000.0
+		maxLng := -1000.0
+		maxLat := -1000.0
+		for _, fir := range radar.FIRs {
+			if fir.Boundaries.Min.Lat < minLat {
+				minLat = fir.Boundaries.Min.Lat
+			}
+			if fir.Boundaries.Min.Lng < minLng {
+				minLng = fir.Boundaries.Min.Lng
+			}
+			if fir.Boundaries.Max.Lat > maxLat {
+				maxLat = fir.Boundaries.Max.Lat
+			}
+			if fir.Boundaries.Max.Lng > maxLng {
+				maxLng = fir.Boundaries.Max.Lng
+			}
 		}
+		rect = geoidx.MakeRect(minLng, minLat, maxLng, maxLat)
 	}
-	rect := geoidx.MakeRect(minLng, minLat, maxLng, maxLat)
 	l = l.WithField("rect", rect)
 
 	iobj := geoidx.NewObject(
@@ -298,9 +485,14 @@ func (p *Provider) setRadar(obj interface{}) error {
 
 	l.Trace("inserting radar to index")
 	p.dataLock.Lock()
+	_, exists := p.radars[radar.Controller.Callsign]
 	p.radars[radar.Controller.Callsign] = &radar
 	p.dataLock.Unlock()
 
+	if !exists && p.synced {
+		p.events.Publish(Event{Type: EventATCLogon, Callsign: radar.Controller.Callsign, Controller: &radar.Controller})
+	}
+
 	return nil
 }
 
@@ -322,28 +514,105 @@ func (p *Provider) deleteRadar(obj interface{}) error {
 		&radar,
 	)
 	l.Trace("deleting radar geo object")
-	p.idx.Delete(iobj)
+	p.idx.Delete(p.indexedObject(iobj))
 
 	l.Trace("deleting radar from index")
 	p.dataLock.Lock()
 	delete(p.radars, radar.Controller.Callsign)
 	p.dataLock.Unlock()
 
+	if p.synced {
+		p.events.Publish(Event{Type: EventATCLogoff, Callsign: radar.Controller.Callsign, Controller: &radar.Controller})
+	}
+
 	return nil
 }
 
+// indexedObject returns the object stored in the index under the same
+// id, the tree removes only the very instance it holds
+func (p *Provider) indexedObject(obj *geoidx.Object) *geoidx.Object {
+	if ex := p.idx.GetObjectByID(obj.ID()); ex != nil {
+		return ex
+	}
+	return obj
+}
+
 func (p *Provider) Subscribe(chSize int) *Subscription {
-	return &Subscription{
-		Subscription:  p.idx.Subscribe(chSize),
-		airportFilter: nil,
-		pilotFilter:   nil,
+	progress := func(pilot *merged.Pilot) (*Progress, bool) {
+		return p.GetProgress(pilot.Callsign)
 	}
+	return newSubscription(p.idx.Subscribe(chSize), progress, p.radarIntersects)
 }
 
 func (p *Provider) Unsubscribe(sub *Subscription) {
 	p.idx.Unsubscribe(sub.Subscription)
 }
 
+func (p *Provider) SubscribeEvents(chSize int, types ...EventType) *EventSubscription {
+	return p.events.Subscribe(chSize, types...)
+}
+
+func (p *Provider) UnsubscribeEvents(es *EventSubscription) {
+	p.events.Unsubscribe(es)
+}
+
+// RecentEvents returns up to limit latest events and the last event seq
+func (p *Provider) RecentEvents(limit int, types ...EventType) ([]Event, uint64) {
+	return p.events.Recent(limit, types...)
+}
+
+// WaitEvents blocks until there are events newer than since
+func (p *Provider) WaitEvents(ctx context.Context, since uint64, types ...EventType) ([]Event, uint64) {
+	return p.events.Wait(ctx, since, types...)
+}
+
+func (p *Provider) completeCycle() {
+	p.cycleLock.Lock()
+	defer p.cycleLock.Unlock()
+	close(p.cycle)
+	p.cycle = make(chan struct{})
+}
+
+// NextCycle returns a channel closed once the current source
+// data cycle is complete
+func (p *Provider) NextCycle() <-chan struct{} {
+	p.cycleLock.Lock()
+	defer p.cycleLock.Unlock()
+	return p.cycle
+}
+
+// IsStale reports whether a pilot or a radar hasn't been
+// refreshed by the source within the configured number of polls
+func (p *Provider) IsStale(obj interface{}) bool {
+	return p.fresh.isStale(obj)
+}
+
+// Status summarises upstream data freshness
+func (p *Provider) Status() Status {
+	st := Status{
+		StaleAfter:  p.fresh.staleAfter.Seconds(),
+		Sources:     p.fresh.sourcesStatus(),
+		TrackWriter: p.trackWriter.Stats(),
+	}
+
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	st.Synced = p.synced
+	st.Pilots = len(p.pilots)
+	for _, pilot := range p.pilots {
+		if p.fresh.isStale(pilot) {
+			st.StalePilots++
+		}
+	}
+	st.Radars = len(p.radars)
+	for _, radar := range p.radars {
+		if p.fresh.isStale(radar) {
+			st.StaleRadars++
+		}
+	}
+	return st
+}
+
 func (p *Provider) GetPilots() []*merged.Pilot {
 	p.dataLock.RLock()
 	pilots := make([]*merged.Pilot, len(p.pilots))
@@ -395,11 +664,15 @@ func (p *Provider) GetAirportByICAO(icao string) (*merged.Airport, error) {
 }
 
 func (p *Provider) SetAirportTrace(icao string) {
-	p.vatsim.SetAirportTrace(icao)
+	if tracer, ok := p.src.(airportTracer); ok {
+		tracer.SetAirportTrace(icao)
+	}
 	p.airportTrace.Add(icao)
 }
 
 func (p *Provider) ResetAirportTrace(icao string) {
-	p.vatsim.ResetAirportTrace(icao)
+	if tracer, ok := p.src.(airportTracer); ok {
+		tracer.ResetAirportTrace(icao)
+	}
 	p.airportTrace.Delete(icao)
 }
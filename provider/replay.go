@@ -0,0 +1,288 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+// Replay plays stored tracks back within a time window. Pilots are
+// reconstructed from track points and fed into a private geo index so
+// replay subscribers get the same events live subscribers do.
+type Replay struct {
+	idx    *geoidx.Index
+	tracks []*replayTrack
+	from   int64
+	to     int64
+
+	now    float64
+	speed  float64
+	paused bool
+	active map[*replayTrack]*geoidx.Object
+
+	stop chan struct{}
+	lock sync.Mutex
+}
+
+type ReplayState struct {
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Time   int64   `json:"ts"`
+	Speed  float64 `json:"speed"`
+	Paused bool    `json:"paused"`
+	Tracks int     `json:"tracks"`
+}
+
+type replayTrack struct {
+	callsign  string
+	cid       int
+	logonTime time.Time
+	points    []track.TrackPoint
+}
+
+const (
+	replayTick     = 1 * time.Second
+	maxReplaySpeed = 3600
+)
+
+var (
+	ErrInvalidWindow = fmt.Errorf("invalid replay time window")
+	ErrInvalidSpeed  = fmt.Errorf("invalid replay speed")
+)
+
+// NewReplay loads points within the window of every stored track
+func NewReplay(ctx context.Context, from time.Time, to time.Time) (*Replay, error) {
+	l := log.WithFields(logrus.Fields{
+		"func": "NewReplay",
+		"from": from,
+		"to":   to,
+	})
+
+	if !from.Before(to) {
+		return nil, ErrInvalidWindow
+	}
+
+	ids, err := track.ListIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replay{
+		idx:    geoidx.NewIndex(),
+		tracks: make([]*replayTrack, 0),
+		from:   from.Unix(),
+		to:     to.Unix(),
+		now:    float64(from.Unix()),
+		speed:  1,
+		paused: true,
+		active: make(map[*replayTrack]*geoidx.Object),
+		stop:   make(chan struct{}),
+	}
+
+	for _, id := range ids {
+		callsign, cid, logonTime, err := track.ParseTrackID(id)
+		if err != nil {
+			l.WithError(err).Debug("skipping track")
+			continue
+		}
+		if logonTime.Unix() > r.to {
+			// the flight hasn't even started by the end of the window
+			continue
+		}
+
+		tr, err := track.LoadTrackWindow(ctx, id, r.from, r.to)
+		if err != nil {
+			l.WithField("track_id", id).WithError(err).Error("error loading track")
+			continue
+		}
+		if len(tr.Points) == 0 ||
+			tr.Points[0].TimeStamp > r.to ||
+			tr.Points[len(tr.Points)-1].TimeStamp < r.from {
+			continue
+		}
+
+		r.tracks = append(r.tracks, &replayTrack{
+			callsign:  callsign,
+			cid:       cid,
+			logonTime: logonTime,
+			points:    tr.Points,
+		})
+	}
+
+	l.WithField("count", len(r.tracks)).Info("replay tracks loaded")
+	return r, nil
+}
+
+// Start runs the replay clock, the replay starts paused
+func (r *Replay) Start() {
+	r.lock.Lock()
+	r.applyUnsafe()
+	r.lock.Unlock()
+	go r.loop()
+}
+
+func (r *Replay) Stop() {
+	close(r.stop)
+}
+
+func (r *Replay) Subscribe(chSize int) *Subscription {
+	return newSubscription(r.idx.Subscribe(chSize), nil, nil)
+}
+
+func (r *Replay) Unsubscribe(sub *Subscription) {
+	r.idx.Unsubscribe(sub.Subscription)
+}
+
+func (r *Replay) Pause() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.paused = true
+}
+
+func (r *Replay) Resume() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if int64(r.now) >= r.to {
+		// replaying from the end makes no sense, start over
+		r.now = float64(r.from)
+		r.applyUnsafe()
+	}
+	r.paused = false
+}
+
+func (r *Replay) SetSpeed(speed float64) error {
+	if speed <= 0 || speed > maxReplaySpeed {
+		return ErrInvalidSpeed
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.speed = speed
+	return nil
+}
+
+// Seek moves the replay clock, it's clamped to the replay window
+func (r *Replay) Seek(t time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ts := t.Unix()
+	if ts < r.from {
+		ts = r.from
+	}
+	if ts > r.to {
+		ts = r.to
+	}
+	r.now = float64(ts)
+	r.applyUnsafe()
+}
+
+func (r *Replay) State() ReplayState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return ReplayState{
+		From:   r.from,
+		To:     r.to,
+		Time:   int64(r.now),
+		Speed:  r.speed,
+		Paused: r.paused,
+		Tracks: len(r.tracks),
+	}
+}
+
+func (r *Replay) loop() {
+	t := time.NewTicker(replayTick)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			r.lock.Lock()
+			if !r.paused {
+				r.now += r.speed * replayTick.Seconds()
+				if int64(r.now) >= r.to {
+					r.now = float64(r.to)
+					r.paused = true
+				}
+				r.applyUnsafe()
+			}
+			r.lock.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// applyUnsafe brings the index in line with the replay clock
+func (r *Replay) applyUnsafe() {
+	now := int64(r.now)
+
+	for _, tr := range r.tracks {
+		pt := tr.pointAt(now)
+		ex, isActive := r.active[tr]
+
+		if pt == nil {
+			if isActive {
+				r.idx.Delete(ex)
+				delete(r.active, tr)
+			}
+			continue
+		}
+
+		if isActive {
+			if expl, ok := ex.Value().(*merged.Pilot); ok && expl.LastUpdated.Unix() == pt.TimeStamp {
+				// nothing has changed since the last tick
+				continue
+			}
+		}
+
+		pilot := tr.makePilot(pt)
+		iobj := geoidx.NewObject(
+			pilot.Callsign,
+			geo.ObjectBox(pilot.Latitude, pilot.Longitude, planeSizeNM/2),
+			pilot,
+		)
+		r.idx.Upsert(iobj)
+		r.active[tr] = iobj
+	}
+}
+
+// pointAt returns the latest point not newer than ts or nil
+// if the flight wasn't online at the moment
+func (tr *replayTrack) pointAt(ts int64) *track.TrackPoint {
+	if len(tr.points) == 0 || ts < tr.points[0].TimeStamp || ts > tr.points[len(tr.points)-1].TimeStamp {
+		return nil
+	}
+	i := sort.Search(len(tr.points), func(i int) bool {
+		return tr.points[i].TimeStamp > ts
+	})
+	return &tr.points[i-1]
+}
+
+// makePilot reconstructs a pilot from a track point. Flight plans
+// are not stored in tracks so replayed pilots don't have them.
+func (tr *replayTrack) makePilot(pt *track.TrackPoint) *merged.Pilot {
+	return &merged.Pilot{
+		Pilot: vatsimapi.Pilot{
+			Cid:         tr.cid,
+			Callsign:    tr.callsign,
+			Latitude:    pt.Latitude,
+			Longitude:   pt.Longitude,
+			Altitude:    pt.Altitude,
+			Groundspeed: pt.Groundspeed,
+			Heading:     pt.Heading,
+			Transponder: pt.Squawk,
+			QnhMb:       pt.QNH,
+			LogonTime:   tr.logonTime,
+			LastUpdated: time.Unix(pt.TimeStamp, 0),
+		},
+	}
+}
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/route"
+)
+
+// PilotRoute is a pilot's filed route geometry and the lateral
+// deviation of the pilot's current position from it
+type PilotRoute struct {
+	*route.Route
+	Polyline    [][2]float64 `json:"polyline"`
+	DeviationNM *float64     `json:"deviation_nm,omitempty"`
+}
+
+// routeCache keeps expanded routes until flight plans change
+type routeCache struct {
+	expander *route.Expander
+	stepNM   float64
+	entries  map[string]*routeEntry
+	lock     sync.Mutex
+}
+
+type routeEntry struct {
+	key      string
+	route    *route.Route
+	polyline [][2]float64
+}
+
+func newRouteCache(cfg config.RoutesConfig, airport route.AirportFunc) *routeCache {
+	l := log.WithFields(logrus.Fields{
+		"func":    "newRouteCache",
+		"navdata": cfg.Navdata,
+	})
+
+	var navdata *route.Navdata
+	if cfg.Navdata != "" {
+		var err error
+		navdata, err = route.LoadNavdata(cfg.Navdata)
+		if err != nil {
+			// routes are still expanded with airports and coordinates
+			l.WithError(err).Error("error loading navdata")
+		} else {
+			fixes, airways := navdata.Counts()
+			l.WithFields(logrus.Fields{
+				"fixes":   fixes,
+				"airways": airways,
+			}).Info("navdata loaded")
+		}
+	}
+
+	return &routeCache{
+		expander: route.NewExpander(navdata, airport),
+		stepNM:   cfg.PolylineStepNM,
+		entries:  make(map[string]*routeEntry),
+	}
+}
+
+func (rc *routeCache) get(pilot *merged.Pilot) *routeEntry {
+	fp := pilot.FlightPlan
+	key := strings.Join([]string{fp.Departure, fp.Arrival, fp.Route}, "|")
+
+	rc.lock.Lock()
+	entry, found := rc.entries[pilot.Callsign]
+	rc.lock.Unlock()
+	if found && entry.key == key {
+		return entry
+	}
+
+	// expanding looks airports up so it's done without holding the lock
+	rte := rc.expander.Expand(fp.Departure, fp.Arrival, fp.Route)
+	entry = &routeEntry{key: key, route: rte, polyline: rte.Polyline(rc.stepNM)}
+	if len(rte.Points) > 1 {
+		// airports may be unknown yet, incomplete routes are retried
+		rc.lock.Lock()
+		rc.entries[pilot.Callsign] = entry
+		rc.lock.Unlock()
+	}
+	return entry
+}
+
+func (rc *routeCache) forget(callsign string) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	delete(rc.entries, callsign)
+}
+
+// GetPilotRoute expands the filed route of a pilot
+func (p *Provider) GetPilotRoute(callsign string) (*PilotRoute, bool) {
+	p.dataLock.RLock()
+	pilot, found := p.pilots[callsign]
+	p.dataLock.RUnlock()
+	if !found || pilot.FlightPlan == nil {
+		return nil, false
+	}
+
+	entry := p.routes.get(pilot)
+	pr := &PilotRoute{Route: entry.route, Polyline: entry.polyline}
+	if dev, ok := entry.route.DeviationNM(pilot.Latitude, pilot.Longitude); ok {
+		pr.DeviationNM = &dev
+	}
+	return pr, true
+}
+
+func (p *Provider) airportPosition(icao string) (float64, float64, bool) {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	arpt, found := p.airports[icao]
+	if !found || arpt.Meta.IsPseudo {
+		return 0, 0, false
+	}
+	return arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, true
+}
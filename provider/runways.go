@@ -0,0 +1,302 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+const (
+	// aircraft heading must be within this of the runway heading
+	runwayMaxHeadingDiff = 30.0
+	// and the aircraft must be this close to the extended centerline
+	runwayMaxCrossTrackNM = 0.5
+	// runways used by less than this share of operations aren't active
+	runwayMinShare = 0.2
+)
+
+type runwayOpKind int
+
+const (
+	runwayOpTakeoff runwayOpKind = iota
+	runwayOpLanding
+)
+
+type (
+	// RunwayUsage is an inferred active runway. Confidence grows with
+	// the share of recent operations using the runway and their number.
+	RunwayUsage struct {
+		Ident      string  `json:"ident"`
+		Ops        int     `json:"ops"`
+		Confidence float64 `json:"confidence"`
+	}
+
+	// ActiveRunways are inferred from takeoffs and landings seen recently
+	ActiveRunways struct {
+		Departure []RunwayUsage `json:"departure"`
+		Arrival   []RunwayUsage `json:"arrival"`
+	}
+
+	runwayOp struct {
+		kind  runwayOpKind
+		ident string
+		ts    time.Time
+	}
+)
+
+// runwayTracker keeps recent runway operations per airport
+type runwayTracker struct {
+	cfg    config.ActiveRunwaysConfig
+	ops    map[string][]runwayOp
+	active map[string]*ActiveRunways
+	lock   sync.RWMutex
+}
+
+func newRunwayTracker(cfg config.ActiveRunwaysConfig) *runwayTracker {
+	return &runwayTracker{
+		cfg:    cfg,
+		ops:    make(map[string][]runwayOp),
+		active: make(map[string]*ActiveRunways),
+	}
+}
+
+// GetActiveRunways returns runways inferred from live traffic, false
+// if there were no recent operations at the airport
+func (p *Provider) GetActiveRunways(icao string) (*ActiveRunways, bool) {
+	rt := p.runways
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+	active, found := rt.active[icao]
+	return active, found
+}
+
+// recordRunwayOp matches a takeoff or a landing to a runway end of the
+// airport, the airport is re-upserted if its active runways change
+func (p *Provider) recordRunwayOp(arpt *merged.Airport, kind runwayOpKind, lat, lng float64, heading int, ts time.Time) {
+	if !p.runways.cfg.Enabled {
+		return
+	}
+	rwy := matchRunway(arpt.Runways, lat, lng, float64(heading))
+	if rwy == nil {
+		return
+	}
+
+	rt := p.runways
+	now := time.Now()
+	rt.lock.Lock()
+	ops := append(rt.ops[arpt.Meta.ICAO], runwayOp{kind: kind, ident: rwy.Ident, ts: ts})
+	if n := len(ops); n > 1 && ts.Before(ops[n-2].ts) {
+		// operations seeded from stored tracks come out of order
+		sort.SliceStable(ops, func(i, j int) bool {
+			return ops[i].ts.Before(ops[j].ts)
+		})
+	}
+	rt.ops[arpt.Meta.ICAO] = ops
+	changed := rt.inferUnsafe(arpt.Meta.ICAO, now)
+	rt.lock.Unlock()
+
+	if changed {
+		p.reindexAirport(arpt.Meta.ICAO)
+	}
+}
+
+// seedRunwayOps replays takeoffs and landings found in tracks stored
+// before the start, so active runways are known right after a restart
+func (p *Provider) seedRunwayOps() {
+	if !p.runways.cfg.Enabled {
+		return
+	}
+	l := log.WithField("func", "seedRunwayOps")
+
+	ctx := context.Background()
+	from, to := p.started.Add(-p.runways.cfg.Window).Unix(), p.started.Unix()-1
+	ids, err := track.ListIDs(ctx)
+	if err != nil {
+		l.WithError(err).Error("error listing tracks")
+		return
+	}
+
+	count := 0
+	for _, id := range ids {
+		_, _, logonTime, err := track.ParseTrackID(id)
+		if err != nil || logonTime.Unix() > to {
+			continue
+		}
+		tr, err := track.LoadTrackWindow(ctx, id, from, to)
+		if err != nil {
+			l.WithField("track_id", id).WithError(err).Error("error loading track")
+			continue
+		}
+
+		// the same rules detectPilotEvents applies to live updates
+		for i := 1; i < len(tr.Points); i++ {
+			prev, point := tr.Points[i-1], tr.Points[i]
+			ts := time.Unix(point.TimeStamp, 0)
+			if prev.OnGround && !point.OnGround {
+				if arpt := p.nearestAirport(prev.Latitude, prev.Longitude, movementAirportRadiusNM); arpt != nil {
+					p.recordRunwayOp(arpt, runwayOpTakeoff, point.Latitude, point.Longitude, point.Heading, ts)
+					count++
+				}
+			} else if !prev.OnGround && point.OnGround {
+				if arpt := p.nearestAirport(point.Latitude, point.Longitude, movementAirportRadiusNM); arpt != nil {
+					p.recordRunwayOp(arpt, runwayOpLanding, point.Latitude, point.Longitude, prev.Heading, ts)
+					count++
+				}
+			}
+		}
+	}
+	l.WithField("movements", count).Debug("runway operations seeded from stored tracks")
+}
+
+// expireRunwayOps drops operations older than the window, called
+// on every data cycle so airports without traffic lose their runways
+func (p *Provider) expireRunwayOps() {
+	rt := p.runways
+	now := time.Now()
+	changed := make([]string, 0)
+
+	rt.lock.Lock()
+	for icao := range rt.ops {
+		if rt.inferUnsafe(icao, now) {
+			changed = append(changed, icao)
+		}
+	}
+	rt.lock.Unlock()
+
+	for _, icao := range changed {
+		p.reindexAirport(icao)
+	}
+}
+
+// inferUnsafe recalculates active runways of an airport and
+// reports whether runway idents have changed
+func (rt *runwayTracker) inferUnsafe(icao string, now time.Time) bool {
+	ops := rt.ops[icao]
+	i := 0
+	for i < len(ops) && now.Sub(ops[i].ts) > rt.cfg.Window {
+		i++
+	}
+	ops = ops[i:]
+
+	prev := rt.active[icao]
+	if len(ops) == 0 {
+		delete(rt.ops, icao)
+		delete(rt.active, icao)
+		return prev != nil
+	}
+	rt.ops[icao] = ops
+
+	active := &ActiveRunways{
+		Departure: rt.usage(ops, runwayOpTakeoff),
+		Arrival:   rt.usage(ops, runwayOpLanding),
+	}
+	rt.active[icao] = active
+	return prev == nil ||
+		!sameIdents(prev.Departure, active.Departure) ||
+		!sameIdents(prev.Arrival, active.Arrival)
+}
+
+func (rt *runwayTracker) usage(ops []runwayOp, kind runwayOpKind) []RunwayUsage {
+	counts := make(map[string]int)
+	total := 0
+	for _, op := range ops {
+		if op.kind == kind {
+			counts[op.ident]++
+			total++
+		}
+	}
+
+	usage := make([]RunwayUsage, 0, len(counts))
+	if total == 0 {
+		return usage
+	}
+	// a single operation is a weak hint, confidence saturates
+	// once there are enough of them
+	volume := 1.0
+	if rt.cfg.ConfidentOps > 0 {
+		volume = math.Min(1, float64(total)/float64(rt.cfg.ConfidentOps))
+	}
+	for ident, count := range counts {
+		share := float64(count) / float64(total)
+		if share < runwayMinShare {
+			continue
+		}
+		usage = append(usage, RunwayUsage{
+			Ident:      ident,
+			Ops:        count,
+			Confidence: math.Round(share*volume*100) / 100,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Ops != usage[j].Ops {
+			return usage[i].Ops > usage[j].Ops
+		}
+		return usage[i].Ident < usage[j].Ident
+	})
+	return usage
+}
+
+func sameIdents(a []RunwayUsage, b []RunwayUsage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Ident != b[i].Ident {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRunway finds the runway end the aircraft is aligned with,
+// parallel runways share headings so the closest centerline wins
+func matchRunway(runways map[string]*ourairports.Runway, lat, lng, heading float64) *ourairports.Runway {
+	var best *ourairports.Runway
+	bestXTD := runwayMaxCrossTrackNM
+
+	for _, rwy := range runways {
+		if rwy.Closed || headingDiff(heading, rwy.Heading) > runwayMaxHeadingDiff {
+			continue
+		}
+		xtd := math.Abs(geo.CrossTrackNM(rwy.Latitude, rwy.Longitude, rwy.Heading, lat, lng))
+		if xtd < bestXTD {
+			best = rwy
+			bestXTD = xtd
+		}
+	}
+	return best
+}
+
+func headingDiff(a float64, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), 360)
+	if diff > 180 {
+		diff = 360 - diff
+	}
+	return diff
+}
+
+// reindexAirport upserts the airport again so subscribers
+// get an update carrying new active runways
+func (p *Provider) reindexAirport(icao string) {
+	p.dataLock.RLock()
+	arpt, found := p.airports[icao]
+	p.dataLock.RUnlock()
+	if !found {
+		return
+	}
+
+	p.idx.Upsert(geoidx.NewObject(
+		arpt.Meta.ICAO,
+		geo.ObjectBox(arpt.Meta.Position.Lat, arpt.Meta.Position.Lng, airportSizeNM/2),
+		arpt,
+	))
+}
@@ -0,0 +1,271 @@
+package provider
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+// snapshot is a provider state persisted to warm start after restarts
+type snapshot struct {
+	CreatedAt time.Time        `json:"created_at"`
+	Airports  []merged.Airport `json:"airports"`
+	Pilots    []merged.Pilot   `json:"pilots"`
+	Radars    []merged.Radar   `json:"radars"`
+}
+
+// snapshotLoop periodically saves provider state until stop is closed,
+// the state is saved one last time on exit
+func (p *Provider) snapshotLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	t := time.NewTicker(p.scfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.saveSnapshot()
+		case <-stop:
+			p.saveSnapshot()
+			return
+		}
+	}
+}
+
+func (p *Provider) saveSnapshot() {
+	l := log.WithFields(logrus.Fields{
+		"func": "saveSnapshot",
+		"path": p.scfg.Path,
+	})
+
+	p.dataLock.RLock()
+	if !p.synced {
+		// a partially loaded or restored state must not
+		// overwrite the previous good snapshot
+		p.dataLock.RUnlock()
+		l.Debug("data is not synced yet, skipping snapshot")
+		return
+	}
+	snap := snapshot{
+		CreatedAt: time.Now(),
+		Airports:  make([]merged.Airport, 0, len(p.airports)),
+		Pilots:    make([]merged.Pilot, 0, len(p.pilots)),
+		Radars:    make([]merged.Radar, 0, len(p.radars)),
+	}
+	for _, arpt := range p.airports {
+		snap.Airports = append(snap.Airports, *arpt)
+	}
+	for _, pilot := range p.pilots {
+		snap.Pilots = append(snap.Pilots, *pilot)
+	}
+	for _, radar := range p.radars {
+		snap.Radars = append(snap.Radars, *radar)
+	}
+	p.dataLock.RUnlock()
+
+	err := writeSnapshot(p.scfg.Path, &snap)
+	if err != nil {
+		l.WithError(err).Error("error saving snapshot")
+		return
+	}
+	l.WithFields(logrus.Fields{
+		"airports": len(snap.Airports),
+		"pilots":   len(snap.Pilots),
+		"radars":   len(snap.Radars),
+	}).Debug("snapshot saved")
+}
+
+// writeSnapshot writes to a temporary file first so a crash
+// never leaves a broken snapshot behind
+func writeSnapshot(path string, snap *snapshot) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	err = json.NewEncoder(gz).Encode(snap)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	snap := &snapshot{}
+	err = json.NewDecoder(gz).Decode(snap)
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// restoreSnapshot loads the last saved state marking every object stale
+// until the source confirms it. Must be called before the provider loop.
+func (p *Provider) restoreSnapshot() error {
+	l := log.WithFields(logrus.Fields{
+		"func": "restoreSnapshot",
+		"path": p.scfg.Path,
+	})
+
+	snap, err := readSnapshot(p.scfg.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			l.Info("no snapshot found, starting cold")
+			return nil
+		}
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	age := time.Since(snap.CreatedAt)
+	if p.scfg.MaxAge > 0 && age > p.scfg.MaxAge {
+		l.WithField("age", age).Info("snapshot is too old, starting cold")
+		return nil
+	}
+
+	for _, arpt := range snap.Airports {
+		p.setAirport(arpt)
+		p.stale[objectKey(arpt)] = true
+	}
+	for _, pilot := range snap.Pilots {
+		p.restorePilot(pilot)
+		p.stale[objectKey(pilot)] = true
+	}
+	for _, radar := range snap.Radars {
+		p.setRadar(radar)
+		p.stale[objectKey(radar)] = true
+	}
+	// restored objects aren't upstream updates
+	p.fresh.reset()
+
+	l.WithFields(logrus.Fields{
+		"age":      age,
+		"airports": len(snap.Airports),
+		"pilots":   len(snap.Pilots),
+		"radars":   len(snap.Radars),
+	}).Info("snapshot restored")
+	return nil
+}
+
+// restorePilot indexes a pilot without setPilot side effects, restored
+// positions may be hours old and must not be written to tracks or fed
+// to progress and runway tracking as fresh samples
+func (p *Provider) restorePilot(pilot merged.Pilot) {
+	iobj := geoidx.NewObject(
+		pilot.Callsign,
+		geo.ObjectBox(pilot.Latitude, pilot.Longitude, planeSizeNM/2),
+		&pilot,
+	)
+	p.idx.Upsert(iobj)
+
+	p.dataLock.Lock()
+	p.pilots[pilot.Callsign] = &pilot
+	p.dataLock.Unlock()
+}
+
+// reconcile removes restored objects the source hasn't confirmed
+// during its first data cycle
+func (p *Provider) reconcile() {
+	if len(p.stale) == 0 {
+		return
+	}
+
+	count := 0
+	for key := range p.stale {
+		p.dataLock.RLock()
+		var obj interface{}
+		switch key.otype {
+		case objectTypeAirport:
+			if arpt, found := p.airports[key.id]; found {
+				obj = *arpt
+			}
+		case objectTypePilot:
+			if pilot, found := p.pilots[key.id]; found {
+				obj = *pilot
+			}
+		case objectTypeRadar:
+			if radar, found := p.radars[key.id]; found {
+				obj = *radar
+			}
+		}
+		p.dataLock.RUnlock()
+
+		switch o := obj.(type) {
+		case merged.Airport:
+			p.deleteAirport(o)
+		case merged.Pilot:
+			p.deletePilot(o)
+		case merged.Radar:
+			p.deleteRadar(o)
+		default:
+			// deleted by the source already
+			continue
+		}
+		count++
+	}
+	p.stale = make(map[staleKey]bool)
+	log.WithField("count", count).Info("stale objects removed after reconciliation")
+}
+
+func (p *Provider) markFresh(obj interface{}) {
+	if len(p.stale) > 0 {
+		delete(p.stale, objectKey(obj))
+	}
+}
+
+const (
+	objectTypeAirport = "arpt"
+	objectTypePilot   = "plt"
+	objectTypeRadar   = "rdr"
+)
+
+type staleKey struct {
+	otype string
+	id    string
+}
+
+func objectKey(obj interface{}) staleKey {
+	switch o := obj.(type) {
+	case merged.Airport:
+		return staleKey{objectTypeAirport, o.Meta.ICAO}
+	case merged.Pilot:
+		return staleKey{objectTypePilot, o.Callsign}
+	case merged.Radar:
+		return staleKey{objectTypeRadar, o.Controller.Callsign}
+	case *merged.Airport:
+		return staleKey{objectTypeAirport, o.Meta.ICAO}
+	case *merged.Pilot:
+		return staleKey{objectTypePilot, o.Callsign}
+	case *merged.Radar:
+		return staleKey{objectTypeRadar, o.Controller.Callsign}
+	}
+	return staleKey{}
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/recorder"
+	"github.com/vatsimnerd/simwatch/synthetic"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+// Source is an upstream update stream the provider is fed by. It must
+// emit merged.Airport, merged.Pilot and merged.Radar values with
+// merged object types and send a fin update at the end of every data
+// cycle, the way merged.Provider does.
+type Source interface {
+	Start() error
+	Stop()
+	Subscribe(chSize int) pubsub.Subscription
+	Unsubscribe(sub pubsub.Subscription)
+}
+
+// airportTracer is implemented by sources supporting
+// per-airport debug tracing
+type airportTracer interface {
+	SetAirportTrace(icao string)
+	ResetAirportTrace(icao string)
+}
+
+var (
+	_ Source        = (*merged.Provider)(nil)
+	_ airportTracer = (*merged.Provider)(nil)
+	_ Source        = (*recorder.Player)(nil)
+	_ Source        = (*synthetic.Generator)(nil)
+)
+
+var (
+	ErrUnknownSourceMode = fmt.Errorf("unknown source mode")
+)
+
+func newSource(cfg *config.Config) (Source, error) {
+	switch cfg.Source.Mode {
+	case "", "live":
+		return merged.New(&cfg.API, &cfg.Data, &cfg.Runways), nil
+	case "replay":
+		log.WithField("dir", cfg.Source.Replay.Dir).Info("using recordings as data source")
+		return recorder.NewPlayer(cfg.Source.Replay), nil
+	case "synthetic":
+		log.WithField("pilots", cfg.Source.Synthetic.Pilots).Info("using synthetic traffic as data source")
+		return synthetic.New(cfg.Source.Synthetic, &cfg.Data), nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownSourceMode, cfg.Source.Mode)
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+// fakeSource lets tests push updates to the provider loop
+type fakeSource struct {
+	*pubsub.Provider
+	subscribed chan struct{}
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		Provider:   pubsub.NewProvider(),
+		subscribed: make(chan struct{}),
+	}
+}
+
+func (fs *fakeSource) Start() error { return nil }
+func (fs *fakeSource) Stop()        {}
+
+func (fs *fakeSource) Subscribe(chSize int) pubsub.Subscription {
+	sub := fs.Provider.Subscribe(chSize)
+	close(fs.subscribed)
+	return sub
+}
+
+func testPilot(callsign string, lat, lng float64) merged.Pilot {
+	return merged.Pilot{
+		Pilot: vatsimapi.Pilot{
+			Cid:         1,
+			Callsign:    callsign,
+			Latitude:    lat,
+			Longitude:   lng,
+			Altitude:    35000,
+			Groundspeed: 450,
+			LogonTime:   time.Unix(1600000000, 0),
+		},
+	}
+}
+
+func TestProviderSource(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Track.Engine = "memory"
+	cfg.Track.Options.PurgePeriod = time.Hour
+
+	src := newFakeSource()
+	p := NewWithSource(cfg, src)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	<-src.subscribed
+
+	// pushes updates and waits for the cycle to be applied
+	cycle := func(updates ...pubsub.Update) {
+		done := p.NextCycle()
+		for _, upd := range updates {
+			src.Notify(upd)
+		}
+		src.Fin()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("data cycle hasn't completed")
+		}
+	}
+	set := func(pilot merged.Pilot) pubsub.Update {
+		return pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypePilot, Obj: pilot}
+	}
+	del := func(pilot merged.Pilot) pubsub.Update {
+		return pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: merged.ObjectTypePilot, Obj: pilot}
+	}
+	indexed := func(lat, lng float64) []string {
+		callsigns := make([]string, 0)
+		rect := geoidx.MakeRect(lng-0.5, lat-0.5, lng+0.5, lat+0.5)
+		for _, obj := range p.idx.SearchByRect(rect) {
+			if pilot, ok := obj.Value().(*merged.Pilot); ok {
+				callsigns = append(callsigns, pilot.Callsign)
+			}
+		}
+		return callsigns
+	}
+
+	cycle(set(testPilot("AAA1", 50, 10)), set(testPilot("BBB2", -30, 150)))
+	if len(p.GetPilots()) != 2 {
+		t.Fatalf("expected 2 pilots, got %d", len(p.GetPilots()))
+	}
+	if got := indexed(50, 10); len(got) != 1 || got[0] != "AAA1" {
+		t.Fatalf("expected AAA1 indexed, got %v", got)
+	}
+
+	// a move is reflected both in the state and in the index
+	cycle(set(testPilot("AAA1", 52, 12)), del(testPilot("BBB2", -30, 150)))
+	pilot, err := p.GetPilotByCallsign("AAA1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pilot.Latitude != 52 || pilot.Longitude != 12 {
+		t.Fatalf("pilot position wasn't updated: %v, %v", pilot.Latitude, pilot.Longitude)
+	}
+	if got := indexed(50, 10); len(got) != 0 {
+		t.Fatalf("old position is still indexed: %v", got)
+	}
+	if got := indexed(52, 12); len(got) != 1 {
+		t.Fatalf("new position isn't indexed: %v", got)
+	}
+
+	_, err = p.GetPilotByCallsign("BBB2")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected deleted pilot to be gone, got %v", err)
+	}
+	if got := indexed(-30, 150); len(got) != 0 {
+		t.Fatalf("deleted pilot is still indexed: %v", got)
+	}
+}
+
+func TestNewUnknownSourceMode(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Source.Mode = "bogus"
+	_, err := New(cfg)
+	if !errors.Is(err, ErrUnknownSourceMode) {
+		t.Fatalf("expected ErrUnknownSourceMode, got %v", err)
+	}
+}
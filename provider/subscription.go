@@ -2,19 +2,54 @@ package provider
 
 import (
 	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/util/set"
 )
 
 type Subscription struct {
 	*geoidx.Subscription
 	airportFilter geoidx.Filter
 	pilotFilter   geoidx.Filter
+	progress      progressFunc
+
+	// the index subscription covers an envelope of the requested rects
+	// and radars are indexed by bounding boxes of their FIRs, exact checks
+	// against the rects and FIR polygons are done by the bounds filter
+	radarIntersects func(*merged.Radar, geoidx.Rect) bool
+	boundsFilter    geoidx.Filter
+	// the index runs filters for objects tracked by id too,
+	// those are followed wherever they are
+	tracked *set.SafeSet[string]
+}
+
+func newSubscription(sub *geoidx.Subscription, progress progressFunc, radarIntersects func(*merged.Radar, geoidx.Rect) bool) *Subscription {
+	return &Subscription{
+		Subscription:    sub,
+		progress:        progress,
+		radarIntersects: radarIntersects,
+		tracked:         set.NewSafe[string](),
+	}
+}
+
+// TrackID follows an object regardless of the bounds. The index diffs
+// objects seen before and after, so the bounds filter learns about the
+// object only after it's tracked and forgets it before it's untracked.
+func (s *Subscription) TrackID(id string) {
+	s.Subscription.TrackID(id)
+	s.tracked.Add(id)
+}
+
+func (s *Subscription) UntrackID(id string) {
+	s.tracked.Delete(id)
+	s.Subscription.UntrackID(id)
 }
 
 func (s *Subscription) SetPilotFilter(query string) error {
 	if query == "" {
 		s.pilotFilter = nil
 	} else {
-		flt, err := pilotFilter(query)
+		flt, err := pilotFilter(query, s.progress)
 		if err != nil {
 			return err
 		}
@@ -29,6 +64,27 @@ func (s *Subscription) SetAirportFilter(includeUncontrolled bool) {
 	s.resetFilters()
 }
 
+// SetBounds subscribes to objects within any of the rects, see
+// ValidateBounds for the accepted forms. Objects are filtered by
+// the new rects within the old boxes first, so that moving boxes
+// afterwards emits the exact diff.
+func (s *Subscription) SetBounds(bounds ...geoidx.Rect) {
+	rects := make([]geoidx.Rect, 0, len(bounds))
+	for _, rect := range bounds {
+		rects = append(rects, geo.SplitRect(rect)...)
+	}
+	if len(rects) == 0 {
+		return
+	}
+
+	inBounds := boundsFilter(rects, s.radarIntersects)
+	s.boundsFilter = func(obj *geoidx.Object) bool {
+		return s.tracked.Has(obj.ID()) || inBounds(obj)
+	}
+	s.resetFilters()
+	s.Subscription.SetBounds(indexBounds(rects))
+}
+
 func (s *Subscription) resetFilters() {
 	filters := make([]geoidx.Filter, 0)
 	if s.airportFilter != nil {
@@ -37,6 +93,9 @@ func (s *Subscription) resetFilters() {
 	if s.pilotFilter != nil {
 		filters = append(filters, s.pilotFilter)
 	}
+	if s.boundsFilter != nil {
+		filters = append(filters, s.boundsFilter)
+	}
 	log.WithField("filter_count", len(filters)).Debug("reset filters")
 	s.SetFilters(filters...)
 }
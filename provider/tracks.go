@@ -9,19 +9,27 @@ import (
 	"github.com/vatsimnerd/simwatch/track/sqlitetr"
 )
 
-func (p *Provider) setupTrackStore() error {
-	switch p.tcfg.Engine {
+// NewTrackEngine creates a track engine of the given name,
+// it must be configured before use
+func NewTrackEngine(name string) (track.TrackReadWriter, error) {
+	switch name {
 	case "memory":
-		log.Info("registering memory track engine")
-		track.RegisterTrackReadWriter(memory.ReadWriter)
+		return memory.New(), nil
 	case "redis":
-		log.Info("registering redis track engine")
-		track.RegisterTrackReadWriter(redistr.ReadWriter)
+		return redistr.New(), nil
 	case "sqlite":
-		log.Info("registering sqlite track engine")
-		track.RegisterTrackReadWriter(sqlitetr.ReadWriter)
+		return sqlitetr.New(), nil
 	default:
-		return fmt.Errorf("invalid track engine '%s'", p.tcfg.Engine)
+		return nil, fmt.Errorf("invalid track engine '%s'", name)
+	}
+}
+
+func (p *Provider) setupTrackStore() error {
+	trw, err := NewTrackEngine(p.tcfg.Engine)
+	if err != nil {
+		return err
 	}
+	log.WithField("engine", p.tcfg.Engine).Info("registering track engine")
+	track.RegisterTrackReadWriter(trw)
 	return track.Configure(&p.tcfg.Options)
 }
@@ -0,0 +1,135 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+// Recordings are gzipped JSON-lines files, one line per update batch.
+// Every file starts with a snapshot record holding the full state so
+// each file can be played on its own. The first batch of a recording
+// session is the full state the source sends on subscribe and is marked
+// as such.
+
+const (
+	filePrefix = "simwatch-"
+	fileSuffix = ".jsonl.gz"
+	fileTime   = "20060102T150405Z"
+
+	uTypeSet = "set"
+	uTypeDel = "del"
+
+	oTypeAirport = "arpt"
+	oTypePilot   = "plt"
+	oTypeRadar   = "rdr"
+
+	// batches further apart than this aren't a continuation of
+	// each other, i.e. the source or simwatch itself was down
+	maxBatchGap = time.Minute
+)
+
+// Batch is a set of updates received between two fin markers.
+// Snapshot batches hold the full state, objects missing from them
+// are gone.
+type Batch struct {
+	Time     time.Time
+	Snapshot bool
+	Updates  []pubsub.Update
+}
+
+type record struct {
+	Time     time.Time `json:"ts"`
+	Snapshot bool      `json:"snapshot,omitempty"`
+	Session  bool      `json:"session,omitempty"`
+	Updates  []update  `json:"updates"`
+}
+
+type update struct {
+	UType string          `json:"u"`
+	OType string          `json:"o"`
+	ID    string          `json:"id"`
+	Obj   json.RawMessage `json:"obj"`
+}
+
+func (u update) key() string {
+	return u.OType + "/" + u.ID
+}
+
+func encodeUpdate(upd pubsub.Update) (update, error) {
+	var enc update
+
+	switch upd.UType {
+	case pubsub.UpdateTypeSet:
+		enc.UType = uTypeSet
+	case pubsub.UpdateTypeDelete:
+		enc.UType = uTypeDel
+	default:
+		return enc, fmt.Errorf("unexpected update type %d", upd.UType)
+	}
+
+	switch obj := upd.Obj.(type) {
+	case merged.Airport:
+		enc.OType = oTypeAirport
+		enc.ID = obj.Meta.ICAO
+	case merged.Pilot:
+		enc.OType = oTypePilot
+		enc.ID = obj.Callsign
+	case merged.Radar:
+		enc.OType = oTypeRadar
+		enc.ID = obj.Controller.Callsign
+	default:
+		return enc, fmt.Errorf("unexpected object type %T", upd.Obj)
+	}
+
+	data, err := json.Marshal(upd.Obj)
+	if err != nil {
+		return enc, err
+	}
+	enc.Obj = data
+	return enc, nil
+}
+
+// decodeUpdate restores an update the way merged provider emits it,
+// i.e. with objects passed by value
+func decodeUpdate(enc update) (pubsub.Update, error) {
+	var upd pubsub.Update
+
+	switch enc.UType {
+	case uTypeSet:
+		upd.UType = pubsub.UpdateTypeSet
+	case uTypeDel:
+		upd.UType = pubsub.UpdateTypeDelete
+	default:
+		return upd, fmt.Errorf("unexpected update type %s", enc.UType)
+	}
+
+	var err error
+	switch enc.OType {
+	case oTypeAirport:
+		var arpt merged.Airport
+		err = json.Unmarshal(enc.Obj, &arpt)
+		upd.OType = merged.ObjectTypeAirport
+		upd.Obj = arpt
+	case oTypePilot:
+		var pilot merged.Pilot
+		err = json.Unmarshal(enc.Obj, &pilot)
+		upd.OType = merged.ObjectTypePilot
+		upd.Obj = pilot
+	case oTypeRadar:
+		var radar merged.Radar
+		err = json.Unmarshal(enc.Obj, &radar)
+		upd.OType = merged.ObjectTypeRadar
+		upd.Obj = radar
+	default:
+		return upd, fmt.Errorf("unexpected object type %s", enc.OType)
+	}
+	return upd, err
+}
+
+func fileName(t time.Time) string {
+	return filePrefix + t.UTC().Format(fileTime) + fileSuffix
+}
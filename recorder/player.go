@@ -0,0 +1,201 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+// Player plays recordings back emitting the same updates merged
+// provider does, batches are delayed according to their timestamps
+// divided by the playback speed. Gaps between recording sessions
+// are shortened to maxBatchGap.
+type Player struct {
+	*pubsub.Provider
+	cfg config.ReplaySourceConfig
+
+	// objects currently known to subscribers
+	state    map[string]pubsub.Update
+	dataLock sync.RWMutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewPlayer(cfg config.ReplaySourceConfig) *Player {
+	return &Player{
+		Provider: pubsub.NewProvider(),
+		cfg:      cfg,
+		state:    make(map[string]pubsub.Update),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *Player) Start() error {
+	if p.cfg.Speed <= 0 {
+		return fmt.Errorf("invalid playback speed %v", p.cfg.Speed)
+	}
+
+	files, err := Files(p.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no recordings found in %s", p.cfg.Dir)
+	}
+
+	p.SetInitialNotifier(func(sub pubsub.Subscription) {
+		// same as merged provider does, don't block subscribe
+		go func() {
+			p.dataLock.RLock()
+			defer p.dataLock.RUnlock()
+			for _, upd := range p.state {
+				sub.Send(upd)
+			}
+			sub.Send(pubsub.Update{UType: pubsub.UpdateTypeFin})
+		}()
+	})
+
+	go p.loop(files)
+	return nil
+}
+
+func (p *Player) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *Player) loop(files []string) {
+	defer close(p.done)
+
+	for {
+		if !p.play(files) {
+			return
+		}
+		if !p.cfg.Loop {
+			log.Info("recordings are over, playback stopped")
+			return
+		}
+		log.Info("recordings are over, starting over")
+		p.clear()
+	}
+}
+
+// play returns false if the playback was stopped or failed
+func (p *Player) play(files []string) bool {
+	l := log.WithFields(logrus.Fields{
+		"func":  "play",
+		"speed": p.cfg.Speed,
+	})
+
+	rd := NewReader(files...)
+	defer rd.Close()
+
+	var prev time.Time
+	for {
+		batch, err := rd.Next()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			l.WithError(err).Error("error reading recording")
+			return false
+		}
+
+		if !prev.IsZero() {
+			gap := batch.Time.Sub(prev)
+			if gap > maxBatchGap {
+				gap = maxBatchGap
+			}
+			delay := time.Duration(float64(gap) / p.cfg.Speed)
+			select {
+			case <-time.After(delay):
+			case <-p.stop:
+				return false
+			}
+		}
+		prev = batch.Time
+
+		l.WithFields(logrus.Fields{
+			"ts":    batch.Time,
+			"count": len(batch.Updates),
+		}).Debug("playing batch")
+		if batch.Snapshot {
+			p.emit(p.reconcile(batch.Updates))
+		} else {
+			p.emit(batch.Updates)
+		}
+
+		select {
+		case <-p.stop:
+			return false
+		default:
+		}
+	}
+}
+
+func (p *Player) emit(updates []pubsub.Update) {
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+
+	for _, upd := range updates {
+		key := objectKey(upd.Obj)
+		if upd.UType == pubsub.UpdateTypeDelete {
+			delete(p.state, key)
+		} else {
+			p.state[key] = upd
+		}
+		p.Notify(upd)
+	}
+	p.SetDataReady(true)
+	p.Fin()
+}
+
+// reconcile prepends deletes of objects missing from a snapshot
+func (p *Player) reconcile(snapshot []pubsub.Update) []pubsub.Update {
+	present := make(map[string]bool, len(snapshot))
+	for _, upd := range snapshot {
+		present[objectKey(upd.Obj)] = true
+	}
+
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+
+	updates := make([]pubsub.Update, 0, len(snapshot))
+	for key, upd := range p.state {
+		if !present[key] {
+			updates = append(updates, pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: upd.OType, Obj: upd.Obj})
+		}
+	}
+	return append(updates, snapshot...)
+}
+
+// clear deletes every known object before playing recordings again
+func (p *Player) clear() {
+	p.dataLock.Lock()
+	updates := make([]pubsub.Update, 0, len(p.state))
+	for _, upd := range p.state {
+		updates = append(updates, pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: upd.OType, Obj: upd.Obj})
+	}
+	p.dataLock.Unlock()
+	p.emit(updates)
+}
+
+func objectKey(obj interface{}) string {
+	switch o := obj.(type) {
+	case merged.Airport:
+		return oTypeAirport + "/" + o.Meta.ICAO
+	case merged.Pilot:
+		return oTypePilot + "/" + o.Callsign
+	case merged.Radar:
+		return oTypeRadar + "/" + o.Controller.Callsign
+	}
+	return ""
+}
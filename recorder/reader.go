@@ -0,0 +1,127 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+const (
+	maxRecordSize = 256 * 1024 * 1024
+)
+
+// Reader reads batches from a sequence of recordings. Snapshot records
+// continuing the previous batch are skipped since the state they hold is
+// already known, the ones following a gap are returned along with the
+// first batches of recording sessions.
+type Reader struct {
+	paths []string
+	idx   int
+	last  time.Time
+
+	file *os.File
+	gz   *gzip.Reader
+	sc   *bufio.Scanner
+}
+
+func NewReader(paths ...string) *Reader {
+	return &Reader{paths: paths, idx: -1}
+}
+
+// Next returns the next batch or io.EOF when all files are read
+func (r *Reader) Next() (*Batch, error) {
+	for {
+		if r.sc == nil {
+			err := r.nextFile()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !r.sc.Scan() {
+			err := r.sc.Err()
+			r.closeFile()
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+			// a file truncated by a crash ends at the last
+			// complete batch, move on to the next one
+			continue
+		}
+
+		var rec record
+		err := json.Unmarshal(r.sc.Bytes(), &rec)
+		if err != nil {
+			if r.idx < len(r.paths)-1 {
+				// partially written last line
+				r.closeFile()
+				continue
+			}
+			return nil, err
+		}
+
+		continued := !r.last.IsZero() && rec.Time.Sub(r.last) <= maxBatchGap
+		if rec.Snapshot && continued {
+			continue
+		}
+		r.last = rec.Time
+
+		batch := &Batch{
+			Time:     rec.Time,
+			Snapshot: rec.Snapshot || rec.Session,
+			Updates:  make([]pubsub.Update, 0, len(rec.Updates)),
+		}
+		for _, enc := range rec.Updates {
+			upd, err := decodeUpdate(enc)
+			if err != nil {
+				return nil, err
+			}
+			batch.Updates = append(batch.Updates, upd)
+		}
+		return batch, nil
+	}
+}
+
+func (r *Reader) Close() {
+	r.closeFile()
+	r.idx = len(r.paths)
+}
+
+func (r *Reader) nextFile() error {
+	r.idx++
+	if r.idx >= len(r.paths) {
+		return io.EOF
+	}
+
+	f, err := os.Open(r.paths[r.idx])
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.gz = gz
+	r.sc = bufio.NewScanner(gz)
+	r.sc.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	return nil
+}
+
+func (r *Reader) closeFile() {
+	if r.file == nil {
+		return
+	}
+	r.gz.Close()
+	r.file.Close()
+	r.file = nil
+	r.sc = nil
+}
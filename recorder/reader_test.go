@@ -0,0 +1,168 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+var t0 = time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func pilotSet(t *testing.T, callsign string) update {
+	t.Helper()
+	enc, err := encodeUpdate(pubsub.Update{
+		UType: pubsub.UpdateTypeSet,
+		OType: merged.ObjectTypePilot,
+		Obj:   merged.Pilot{Pilot: vatsimapi.Pilot{Callsign: callsign}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// writeRecording writes records to a file named after the first one
+func writeRecording(t *testing.T, dir string, records ...record) string {
+	t.Helper()
+	path := filepath.Join(dir, fileName(records[0].Time))
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeSessions writes two recording sessions two hours apart,
+// BBB2 disconnects while simwatch is down
+func writeSessions(t *testing.T, dir string) {
+	t.Helper()
+	t1 := t0.Add(30 * time.Second)
+	t2 := t0.Add(2 * time.Hour)
+
+	writeRecording(t, dir,
+		record{Time: t0, Session: true, Updates: []update{pilotSet(t, "AAA1"), pilotSet(t, "BBB2")}},
+		record{Time: t0.Add(15 * time.Second), Updates: []update{pilotSet(t, "AAA1")}},
+	)
+	// rotation within the session
+	writeRecording(t, dir,
+		record{Time: t1, Snapshot: true, Updates: []update{pilotSet(t, "AAA1"), pilotSet(t, "BBB2")}},
+		record{Time: t1, Updates: []update{pilotSet(t, "BBB2")}},
+	)
+	writeRecording(t, dir,
+		record{Time: t2, Session: true, Updates: []update{pilotSet(t, "AAA1")}},
+	)
+}
+
+func TestReaderSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	writeSessions(t, dir)
+	// a source outage within the session
+	writeRecording(t, dir,
+		record{Time: t0.Add(3 * time.Hour), Snapshot: true, Updates: []update{pilotSet(t, "AAA1")}},
+	)
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd := NewReader(files...)
+	defer rd.Close()
+
+	expected := []struct {
+		ts       time.Time
+		snapshot bool
+		count    int
+	}{
+		{t0, true, 2},
+		{t0.Add(15 * time.Second), false, 1},
+		// the rotation snapshot continues the previous batch
+		{t0.Add(30 * time.Second), false, 1},
+		{t0.Add(2 * time.Hour), true, 1},
+		{t0.Add(3 * time.Hour), true, 1},
+	}
+
+	for i, exp := range expected {
+		batch, err := rd.Next()
+		if err != nil {
+			t.Fatalf("batch %d: %v", i, err)
+		}
+		if !batch.Time.Equal(exp.ts) || batch.Snapshot != exp.snapshot || len(batch.Updates) != exp.count {
+			t.Fatalf("batch %d: expected %v snapshot=%v with %d updates, got %v snapshot=%v with %d updates",
+				i, exp.ts, exp.snapshot, exp.count, batch.Time, batch.Snapshot, len(batch.Updates))
+		}
+	}
+	if _, err := rd.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReaderStartsWithSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := writeRecording(t, dir,
+		record{Time: t0, Snapshot: true, Updates: []update{pilotSet(t, "AAA1")}},
+		record{Time: t0, Updates: []update{pilotSet(t, "BBB2")}},
+	)
+
+	rd := NewReader(path)
+	defer rd.Close()
+
+	batch, err := rd.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.Snapshot {
+		t.Fatal("a file played on its own must start with its snapshot")
+	}
+}
+
+func TestPlayerSessionGap(t *testing.T) {
+	dir := t.TempDir()
+	writeSessions(t, dir)
+
+	// the two hour gap takes 7.2s unless it's shortened
+	p := NewPlayer(config.ReplaySourceConfig{Dir: dir, Speed: 1000})
+	start := time.Now()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		p.Stop()
+		t.Fatal("playback slept through the gap between sessions")
+	}
+	if elapsed := time.Since(start); elapsed < maxBatchGap/1000 {
+		t.Fatalf("playback finished in %v, gaps must still be played", elapsed)
+	}
+
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	if len(p.state) != 1 {
+		t.Fatalf("expected a single pilot left, got %v", p.state)
+	}
+	if _, ok := p.state[oTypePilot+"/AAA1"]; !ok {
+		t.Fatalf("expected AAA1 to be left, got %v", p.state)
+	}
+}
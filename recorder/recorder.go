@@ -0,0 +1,218 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+var (
+	log = logrus.WithField("module", "recorder")
+)
+
+// Recorder saves provider update batches to rotated files. Add and
+// Commit are meant to be called from a single goroutine, the files are
+// written by the recorder's own one.
+type Recorder struct {
+	cfg     config.RecorderConfig
+	pending []pubsub.Update
+	queue   chan Batch
+	done    chan struct{}
+
+	// the following is owned by the writer goroutine
+	state    map[string]update
+	file     *os.File
+	gz       *gzip.Writer
+	buf      *bufio.Writer
+	openedAt time.Time
+	started  bool
+}
+
+func New(cfg config.RecorderConfig) *Recorder {
+	return &Recorder{
+		cfg:     cfg,
+		pending: make([]pubsub.Update, 0),
+		queue:   make(chan Batch, cfg.QueueSize),
+		done:    make(chan struct{}),
+		state:   make(map[string]update),
+	}
+}
+
+func (r *Recorder) Start() error {
+	err := os.MkdirAll(r.cfg.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	go r.loop()
+	return nil
+}
+
+// Stop writes out queued batches and closes the current file
+func (r *Recorder) Stop() {
+	close(r.queue)
+	<-r.done
+}
+
+// Add accumulates an update for the current batch
+func (r *Recorder) Add(upd pubsub.Update) {
+	r.pending = append(r.pending, upd)
+}
+
+// Commit queues the accumulated updates as a batch
+func (r *Recorder) Commit() {
+	if len(r.pending) == 0 {
+		return
+	}
+	batch := Batch{Time: time.Now(), Updates: r.pending}
+	r.pending = make([]pubsub.Update, 0, len(batch.Updates))
+
+	select {
+	case r.queue <- batch:
+	default:
+		log.WithField("count", len(batch.Updates)).Error("recorder queue is full, batch dropped")
+	}
+}
+
+func (r *Recorder) loop() {
+	defer close(r.done)
+	defer r.closeFile()
+
+	for batch := range r.queue {
+		err := r.write(batch)
+		if err != nil {
+			log.WithError(err).Error("error recording batch")
+		}
+	}
+}
+
+func (r *Recorder) write(batch Batch) error {
+	if r.file == nil || batch.Time.Sub(r.openedAt) >= r.cfg.RotatePeriod {
+		err := r.rotate(batch.Time)
+		if err != nil {
+			return err
+		}
+	}
+
+	rec := record{Time: batch.Time, Session: !r.started, Updates: make([]update, 0, len(batch.Updates))}
+	for _, upd := range batch.Updates {
+		enc, err := encodeUpdate(upd)
+		if err != nil {
+			log.WithError(err).Debug("skipping update")
+			continue
+		}
+		rec.Updates = append(rec.Updates, enc)
+		if enc.UType == uTypeDel {
+			delete(r.state, enc.key())
+		} else {
+			r.state[enc.key()] = enc
+		}
+	}
+	err := r.writeRecord(rec)
+	if err != nil {
+		return err
+	}
+	r.started = true
+	return nil
+}
+
+func (r *Recorder) writeRecord(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = r.buf.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	err = r.buf.Flush()
+	if err != nil {
+		return err
+	}
+	// keep the file readable up to the last batch in case of a crash
+	return r.gz.Flush()
+}
+
+func (r *Recorder) rotate(now time.Time) error {
+	r.closeFile()
+
+	path := filepath.Join(r.cfg.Dir, fileName(now))
+	log.WithField("path", path).Info("opening new recording file")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.gz = gzip.NewWriter(f)
+	r.buf = bufio.NewWriter(r.gz)
+	r.openedAt = now
+
+	if len(r.state) > 0 {
+		snapshot := record{Time: now, Snapshot: true, Updates: make([]update, 0, len(r.state))}
+		for _, enc := range r.state {
+			snapshot.Updates = append(snapshot.Updates, enc)
+		}
+		err = r.writeRecord(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.cleanup(now)
+	return nil
+}
+
+func (r *Recorder) closeFile() {
+	if r.file == nil {
+		return
+	}
+	r.buf.Flush()
+	r.gz.Close()
+	r.file.Close()
+	r.file = nil
+}
+
+// cleanup removes recordings older than retention period
+func (r *Recorder) cleanup(now time.Time) {
+	if r.cfg.Retention <= 0 {
+		return
+	}
+
+	files, err := Files(r.cfg.Dir)
+	if err != nil {
+		log.WithError(err).Error("error listing recordings")
+		return
+	}
+
+	for _, path := range files {
+		ts, err := time.Parse(fileTime, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filePrefix), fileSuffix))
+		if err != nil || now.Sub(ts) < r.cfg.Retention {
+			continue
+		}
+		log.WithField("path", path).Info("removing expired recording")
+		err = os.Remove(path)
+		if err != nil {
+			log.WithError(err).Error("error removing recording")
+		}
+	}
+}
+
+// Files lists recordings found in dir in chronological order
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	// timestamps in names sort lexicographically
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,91 @@
+package route
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// ICAO forms: 46N078W, 4620N07805W, 462034N0780512W
+	reICAOCoord = regexp.MustCompile(`^(\d{2})(\d{2})?(\d{2})?([NS])(\d{3})(\d{2})?(\d{2})?([EW])$`)
+	// ARINC 424 forms: 5040N is 50N040W, 50N40 is 50N140W
+	reARINCCoord = regexp.MustCompile(`^(\d{2})(\d{2})([NESW])$|^(\d{2})([NESW])(\d{2})$`)
+
+	// ARINC 424 letters stand for a quadrant
+	arincQuadrants = map[string][2]float64{
+		"N": {1, -1},
+		"E": {1, 1},
+		"S": {-1, 1},
+		"W": {-1, -1},
+	}
+)
+
+// parseCoord understands ICAO and ARINC 424 coordinate waypoints
+func parseCoord(token string) (float64, float64, bool) {
+	if m := reICAOCoord.FindStringSubmatch(token); m != nil {
+		// minutes and seconds come in pairs for both coordinates
+		if (m[2] == "") != (m[6] == "") || (m[3] == "") != (m[7] == "") {
+			return 0, 0, false
+		}
+		lat, ok := dms(m[1], m[2], m[3])
+		if !ok {
+			return 0, 0, false
+		}
+		lng, ok := dms(m[5], m[6], m[7])
+		if !ok {
+			return 0, 0, false
+		}
+		if m[4] == "S" {
+			lat = -lat
+		}
+		if m[8] == "W" {
+			lng = -lng
+		}
+		if lat > 90 || lng > 180 || lat < -90 || lng < -180 {
+			return 0, 0, false
+		}
+		return lat, lng, true
+	}
+
+	if m := reARINCCoord.FindStringSubmatch(token); m != nil {
+		var lat, lng float64
+		var quadrant string
+		if m[1] != "" {
+			lat, _ = strconv.ParseFloat(m[1], 64)
+			lng, _ = strconv.ParseFloat(m[2], 64)
+			quadrant = m[3]
+		} else {
+			lat, _ = strconv.ParseFloat(m[4], 64)
+			lng, _ = strconv.ParseFloat(m[6], 64)
+			lng += 100
+			quadrant = m[5]
+		}
+		if lat > 90 || lng > 180 {
+			return 0, 0, false
+		}
+		q := arincQuadrants[quadrant]
+		return lat * q[0], lng * q[1], true
+	}
+	return 0, 0, false
+}
+
+// dms converts degrees, minutes and seconds to degrees, minutes
+// and seconds must be below 60
+func dms(deg, min, sec string) (float64, bool) {
+	v, _ := strconv.ParseFloat(deg, 64)
+	if min != "" {
+		m, _ := strconv.ParseFloat(min, 64)
+		if m >= 60 {
+			return 0, false
+		}
+		v += m / 60
+	}
+	if sec != "" {
+		s, _ := strconv.ParseFloat(sec, 64)
+		if s >= 60 {
+			return 0, false
+		}
+		v += s / 3600
+	}
+	return v, true
+}
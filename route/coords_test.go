@@ -0,0 +1,63 @@
+package route
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCoord(t *testing.T) {
+	tcs := []struct {
+		token    string
+		ok       bool
+		lat, lng float64
+	}{
+		// ICAO forms
+		{"46N078W", true, 46, -78},
+		{"4620N07805W", true, 46 + 20.0/60, -(78 + 5.0/60)},
+		{"462034N0780512W", true, 46 + 20.0/60 + 34.0/3600, -(78 + 5.0/60 + 12.0/3600)},
+		{"00N000E", true, 0, 0},
+		{"90S180E", true, -90, 180},
+		{"4620N07805E", true, 46 + 20.0/60, 78 + 5.0/60},
+		{"4620S07805W", true, -(46 + 20.0/60), -(78 + 5.0/60)},
+		// minutes and seconds must be below 60
+		{"4699N07800W", false, 0, 0},
+		{"4600N07860W", false, 0, 0},
+		{"462060N0780512W", false, 0, 0},
+		{"462034N0780599W", false, 0, 0},
+		// out of range
+		{"91N078W", false, 0, 0},
+		{"46N181W", false, 0, 0},
+		// minutes given for one coordinate only
+		{"4620N078W", false, 0, 0},
+		{"46N07805W", false, 0, 0},
+
+		// ARINC 424 forms
+		{"5040N", true, 50, -40},
+		{"5040E", true, 50, 40},
+		{"5040S", true, -50, 40},
+		{"5040W", true, -50, -40},
+		{"50N40", true, 50, -140},
+		{"50E40", true, 50, 140},
+		{"50S40", true, -50, 140},
+		{"50W40", true, -50, -140},
+		{"50N90", false, 0, 0},
+
+		// not coordinates at all
+		{"WAL", false, 0, 0},
+		{"EGLL", false, 0, 0},
+		{"UL9", false, 0, 0},
+		{"N0450F350", false, 0, 0},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.token, func(t *testing.T) {
+			lat, lng, ok := parseCoord(tc.token)
+			if ok != tc.ok {
+				t.Fatalf("expected ok=%v, got %v (%v, %v)", tc.ok, ok, lat, lng)
+			}
+			if ok && (math.Abs(lat-tc.lat) > 1e-9 || math.Abs(lng-tc.lng) > 1e-9) {
+				t.Fatalf("expected %v, %v, got %v, %v", tc.lat, tc.lng, lat, lng)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package route
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+// Fix is a named point, fix names aren't unique worldwide
+type Fix struct {
+	Name string
+	Lat  float64
+	Lng  float64
+}
+
+// Navdata keeps fixes and airways loaded from a navdata file. The file
+// is plain text, one record per line, blank lines and lines starting
+// with # are ignored:
+//
+//	FIX <name> <lat> <lng>
+//	AWY <name> <fix> <fix> [<fix>...]
+//
+// Airway fixes are listed in order, an airway may be defined by several
+// AWY lines e.g. for disconnected segments.
+type Navdata struct {
+	fixes   map[string][]Fix
+	airways map[string][][]string
+}
+
+func NewNavdata() *Navdata {
+	return &Navdata{
+		fixes:   make(map[string][]Fix),
+		airways: make(map[string][][]string),
+	}
+}
+
+// LoadNavdata reads a navdata file
+func LoadNavdata(path string) (*Navdata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	nd := NewNavdata()
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := nd.parseLine(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+func (nd *Navdata) parseLine(line string) error {
+	fields := strings.Fields(strings.ToUpper(line))
+	switch fields[0] {
+	case "FIX":
+		if len(fields) != 4 {
+			return fmt.Errorf("FIX needs a name, a latitude and a longitude")
+		}
+		lat, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || math.Abs(lat) > 90 {
+			return fmt.Errorf("invalid latitude %q", fields[2])
+		}
+		lng, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil || math.Abs(lng) > 180 {
+			return fmt.Errorf("invalid longitude %q", fields[3])
+		}
+		nd.AddFix(Fix{Name: fields[1], Lat: lat, Lng: lng})
+	case "AWY":
+		if len(fields) < 4 {
+			return fmt.Errorf("AWY needs a name and at least two fixes")
+		}
+		nd.AddAirway(fields[1], fields[2:])
+	default:
+		return fmt.Errorf("unknown record type %q", fields[0])
+	}
+	return nil
+}
+
+func (nd *Navdata) AddFix(fix Fix) {
+	nd.fixes[fix.Name] = append(nd.fixes[fix.Name], fix)
+}
+
+func (nd *Navdata) AddAirway(name string, fixes []string) {
+	nd.airways[name] = append(nd.airways[name], fixes)
+}
+
+// Counts returns the number of fixes and airway segments loaded
+func (nd *Navdata) Counts() (fixes int, airways int) {
+	for _, fx := range nd.fixes {
+		fixes += len(fx)
+	}
+	for _, segs := range nd.airways {
+		airways += len(segs)
+	}
+	return
+}
+
+// nearestFix picks a fix with the given name closest to the point
+func (nd *Navdata) nearestFix(name string, lat, lng float64) (Fix, bool) {
+	candidates := nd.fixes[name]
+	if len(candidates) == 0 {
+		return Fix{}, false
+	}
+
+	best := candidates[0]
+	bestDist := geo.DistanceNM(lat, lng, best.Lat, best.Lng)
+	for _, fix := range candidates[1:] {
+		if dist := geo.DistanceNM(lat, lng, fix.Lat, fix.Lng); dist < bestDist {
+			best = fix
+			bestDist = dist
+		}
+	}
+	return best, true
+}
+
+// airwaySegment returns fix names between from and to along an airway,
+// both ends excluded, in the direction of flight
+func (nd *Navdata) airwaySegment(airway, from, to string) ([]string, bool) {
+	for _, fixes := range nd.airways[airway] {
+		i, j := -1, -1
+		for k, name := range fixes {
+			if name == from && i < 0 {
+				i = k
+			}
+			if name == to && j < 0 {
+				j = k
+			}
+		}
+		if i < 0 || j < 0 || i == j {
+			continue
+		}
+
+		between := make([]string, 0)
+		if i < j {
+			between = append(between, fixes[i+1:j]...)
+		} else {
+			for k := i - 1; k > j; k-- {
+				between = append(between, fixes[k])
+			}
+		}
+		return between, true
+	}
+	return nil, false
+}
+
+func (nd *Navdata) isAirway(name string) bool {
+	_, found := nd.airways[name]
+	return found
+}
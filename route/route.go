@@ -0,0 +1,236 @@
+// Package route expands filed flight plan routes into geometry
+package route
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+type PointKind string
+
+const (
+	PointKindAirport PointKind = "airport"
+	PointKindFix     PointKind = "fix"
+	PointKindCoord   PointKind = "coord"
+)
+
+var (
+	// speed and level groups like N0450F350 or M079F370
+	reSpeedLevel = regexp.MustCompile(`^[NKM]\d{3,4}([FAMS]\d{3,4}|VFR)?$`)
+
+	skipTokens = map[string]bool{
+		"DCT":  true,
+		"IFR":  true,
+		"VFR":  true,
+		"SID":  true,
+		"STAR": true,
+	}
+)
+
+type (
+	// Point is a resolved route waypoint
+	Point struct {
+		Name string    `json:"name"`
+		Kind PointKind `json:"kind"`
+		Lat  float64   `json:"lat"`
+		Lng  float64   `json:"lng"`
+	}
+
+	// Route is a filed route expanded to waypoints, Unresolved lists
+	// tokens which are neither known points nor airways e.g. SIDs
+	Route struct {
+		Points     []Point  `json:"points"`
+		Unresolved []string `json:"unresolved"`
+	}
+
+	// AirportFunc looks an airport position up by its ICAO code
+	AirportFunc func(icao string) (lat float64, lng float64, found bool)
+)
+
+// Expander resolves route strings, navdata is optional
+type Expander struct {
+	navdata *Navdata
+	airport AirportFunc
+}
+
+func NewExpander(navdata *Navdata, airport AirportFunc) *Expander {
+	if navdata == nil {
+		navdata = NewNavdata()
+	}
+	return &Expander{navdata: navdata, airport: airport}
+}
+
+// Expand turns a filed route into waypoints starting at the departure
+// and ending at the arrival airport if those are known. Named fixes are
+// resolved to the ones nearest to the previous point, airways are
+// expanded if both the entry and the exit fix are on them.
+func (e *Expander) Expand(dep string, arr string, rte string) *Route {
+	r := &Route{Points: make([]Point, 0), Unresolved: make([]string, 0)}
+	e.addAirport(r, dep)
+
+	// an airway waits for its exit fix
+	airway := ""
+	for _, token := range strings.Fields(strings.ToUpper(rte)) {
+		// speed/level changes like WAL/N0450F350 and runways like EGLL/27R
+		if i := strings.Index(token, "/"); i >= 0 {
+			token = token[:i]
+		}
+		if token == "" || skipTokens[token] || reSpeedLevel.MatchString(token) {
+			continue
+		}
+
+		if lat, lng, ok := parseCoord(token); ok {
+			e.flushAirway(r, &airway)
+			r.add(Point{Name: token, Kind: PointKindCoord, Lat: lat, Lng: lng})
+			continue
+		}
+
+		if len(token) == 4 && e.airport != nil {
+			if lat, lng, ok := e.airport(token); ok {
+				e.flushAirway(r, &airway)
+				r.add(Point{Name: token, Kind: PointKindAirport, Lat: lat, Lng: lng})
+				continue
+			}
+		}
+
+		if last, ok := r.last(); ok && last.Kind == PointKindFix && airway == "" && e.navdata.isAirway(token) {
+			airway = token
+			continue
+		}
+
+		ref, hasRef := r.last()
+		if !hasRef {
+			// the departure is unknown, fixes are resolved around the arrival
+			if lat, lng, ok := e.lookupAirport(arr); ok {
+				ref = Point{Lat: lat, Lng: lng}
+			}
+		}
+		fix, ok := e.navdata.nearestFix(token, ref.Lat, ref.Lng)
+		if !ok {
+			e.flushAirway(r, &airway)
+			r.Unresolved = append(r.Unresolved, token)
+			continue
+		}
+
+		if airway != "" {
+			e.expandAirway(r, airway, ref.Name, fix.Name)
+			airway = ""
+		}
+		r.add(Point{Name: fix.Name, Kind: PointKindFix, Lat: fix.Lat, Lng: fix.Lng})
+	}
+	e.flushAirway(r, &airway)
+
+	e.addAirport(r, arr)
+	return r
+}
+
+func (e *Expander) lookupAirport(icao string) (float64, float64, bool) {
+	icao = strings.ToUpper(strings.TrimSpace(icao))
+	if icao == "" || e.airport == nil {
+		return 0, 0, false
+	}
+	return e.airport(icao)
+}
+
+func (e *Expander) addAirport(r *Route, icao string) {
+	if lat, lng, ok := e.lookupAirport(icao); ok {
+		r.add(Point{Name: strings.ToUpper(strings.TrimSpace(icao)), Kind: PointKindAirport, Lat: lat, Lng: lng})
+	}
+}
+
+func (e *Expander) expandAirway(r *Route, airway string, from string, to string) {
+	names, ok := e.navdata.airwaySegment(airway, from, to)
+	if !ok {
+		// flown direct then
+		r.Unresolved = append(r.Unresolved, airway)
+		return
+	}
+	for _, name := range names {
+		last, _ := r.last()
+		fix, ok := e.navdata.nearestFix(name, last.Lat, last.Lng)
+		if !ok {
+			r.Unresolved = append(r.Unresolved, name)
+			continue
+		}
+		r.add(Point{Name: fix.Name, Kind: PointKindFix, Lat: fix.Lat, Lng: fix.Lng})
+	}
+}
+
+// flushAirway drops an airway not followed by a fix
+func (e *Expander) flushAirway(r *Route, airway *string) {
+	if *airway != "" {
+		r.Unresolved = append(r.Unresolved, *airway)
+		*airway = ""
+	}
+}
+
+// add appends a point unless it repeats the last one,
+// e.g. the departure airport filed as the first token
+func (r *Route) add(pt Point) {
+	if last, ok := r.last(); ok && last.Name == pt.Name && last.Lat == pt.Lat && last.Lng == pt.Lng {
+		return
+	}
+	r.Points = append(r.Points, pt)
+}
+
+func (r *Route) last() (Point, bool) {
+	if len(r.Points) == 0 {
+		return Point{}, false
+	}
+	return r.Points[len(r.Points)-1], true
+}
+
+// Polyline returns [lat, lng] pairs of the route with legs longer than
+// stepNM split along great circles, so that long legs drawn on a map
+// follow the actual path
+func (r *Route) Polyline(stepNM float64) [][2]float64 {
+	line := make([][2]float64, 0, len(r.Points))
+	for i, pt := range r.Points {
+		if i > 0 && stepNM > 0 {
+			prev := r.Points[i-1]
+			dist := geo.DistanceNM(prev.Lat, prev.Lng, pt.Lat, pt.Lng)
+			steps := int(math.Ceil(dist / stepNM))
+			for s := 1; s < steps; s++ {
+				lat, lng := geo.Intermediate(prev.Lat, prev.Lng, pt.Lat, pt.Lng, float64(s)/float64(steps))
+				line = append(line, [2]float64{lat, lng})
+			}
+		}
+		line = append(line, [2]float64{pt.Lat, pt.Lng})
+	}
+	return line
+}
+
+// DeviationNM is the distance from a point to the closest leg of the
+// route, false is returned for routes having less than two points
+func (r *Route) DeviationNM(lat float64, lng float64) (float64, bool) {
+	if len(r.Points) < 2 {
+		return 0, false
+	}
+
+	min := math.Inf(1)
+	for i := 1; i < len(r.Points); i++ {
+		a, b := r.Points[i-1], r.Points[i]
+		min = math.Min(min, legDistanceNM(a, b, lat, lng))
+	}
+	return min, true
+}
+
+func legDistanceNM(a Point, b Point, lat float64, lng float64) float64 {
+	legNM := geo.DistanceNM(a.Lat, a.Lng, b.Lat, b.Lng)
+	if legNM == 0 {
+		return geo.DistanceNM(a.Lat, a.Lng, lat, lng)
+	}
+
+	course := geo.Bearing(a.Lat, a.Lng, b.Lat, b.Lng)
+	along := geo.AlongTrackNM(a.Lat, a.Lng, course, lat, lng)
+	switch {
+	case along <= 0:
+		return geo.DistanceNM(a.Lat, a.Lng, lat, lng)
+	case along >= legNM:
+		return geo.DistanceNM(b.Lat, b.Lng, lat, lng)
+	}
+	return math.Abs(geo.CrossTrackNM(a.Lat, a.Lng, course, lat, lng))
+}
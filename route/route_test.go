@@ -0,0 +1,177 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testExpander() *Expander {
+	nd := NewNavdata()
+	for _, fix := range []Fix{
+		{Name: "ALPHA", Lat: 51, Lng: 0},
+		{Name: "BRAVO", Lat: 51, Lng: 1},
+		{Name: "CHARL", Lat: 51, Lng: 2},
+		{Name: "DELTA", Lat: 51, Lng: 3},
+		// fix names aren't unique worldwide
+		{Name: "ECHO", Lat: 51, Lng: 4},
+		{Name: "ECHO", Lat: -33, Lng: 151},
+		{Name: "FOXTR", Lat: -34, Lng: 151},
+	} {
+		nd.AddFix(fix)
+	}
+	nd.AddAirway("UL9", []string{"ALPHA", "BRAVO", "CHARL", "DELTA"})
+
+	airports := map[string][2]float64{
+		"EGLL": {51.47, -0.46},
+		"EHAM": {52.31, 4.76},
+		"YSSY": {-33.95, 151.18},
+	}
+	return NewExpander(nd, func(icao string) (float64, float64, bool) {
+		pos, found := airports[icao]
+		return pos[0], pos[1], found
+	})
+}
+
+// names lists point names with kinds for compact comparison
+func names(r *Route) []string {
+	list := make([]string, len(r.Points))
+	for i, pt := range r.Points {
+		list[i] = string(pt.Kind) + ":" + pt.Name
+	}
+	return list
+}
+
+func TestExpand(t *testing.T) {
+	tcs := []struct {
+		name       string
+		dep, arr   string
+		rte        string
+		points     []string
+		unresolved []string
+	}{
+		{
+			name:   "direct fixes",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "ALPHA DCT DELTA",
+			points: []string{"airport:EGLL", "fix:ALPHA", "fix:DELTA", "airport:EHAM"},
+		},
+		{
+			name:   "airway",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "ALPHA UL9 DELTA",
+			points: []string{"airport:EGLL", "fix:ALPHA", "fix:BRAVO", "fix:CHARL", "fix:DELTA", "airport:EHAM"},
+		},
+		{
+			name:   "reversed airway",
+			dep:    "EHAM",
+			arr:    "EGLL",
+			rte:    "DELTA UL9 ALPHA",
+			points: []string{"airport:EHAM", "fix:DELTA", "fix:CHARL", "fix:BRAVO", "fix:ALPHA", "airport:EGLL"},
+		},
+		{
+			name:   "partial airway",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "BRAVO UL9 DELTA",
+			points: []string{"airport:EGLL", "fix:BRAVO", "fix:CHARL", "fix:DELTA", "airport:EHAM"},
+		},
+		{
+			name:       "airway without exit fix",
+			dep:        "EGLL",
+			arr:        "EHAM",
+			rte:        "ALPHA UL9",
+			points:     []string{"airport:EGLL", "fix:ALPHA", "airport:EHAM"},
+			unresolved: []string{"UL9"},
+		},
+		{
+			name:   "speed and level groups",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "N0450F350 ALPHA/N0460F370 DCT BRAVO M079F390 K0830S1130 DELTA/N0300VFR",
+			points: []string{"airport:EGLL", "fix:ALPHA", "fix:BRAVO", "fix:DELTA", "airport:EHAM"},
+		},
+		{
+			name:   "runways and airports in the route",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "EGLL/27R ALPHA DELTA EHAM/18R",
+			points: []string{"airport:EGLL", "fix:ALPHA", "fix:DELTA", "airport:EHAM"},
+		},
+		{
+			name:   "lower case",
+			dep:    "egll",
+			arr:    "eham",
+			rte:    "alpha ul9 charl",
+			points: []string{"airport:EGLL", "fix:ALPHA", "fix:BRAVO", "fix:CHARL", "airport:EHAM"},
+		},
+		{
+			name:   "coordinates",
+			dep:    "EGLL",
+			arr:    "EHAM",
+			rte:    "ALPHA 5130N00200E 5200N DCT 52N005E",
+			points: []string{"airport:EGLL", "fix:ALPHA", "coord:5130N00200E", "coord:5200N", "coord:52N005E", "airport:EHAM"},
+		},
+		{
+			name:       "invalid coordinates",
+			dep:        "EGLL",
+			arr:        "EHAM",
+			rte:        "ALPHA 5199N00200E DELTA",
+			points:     []string{"airport:EGLL", "fix:ALPHA", "fix:DELTA", "airport:EHAM"},
+			unresolved: []string{"5199N00200E"},
+		},
+		{
+			name:   "unknown departure",
+			dep:    "ZZZZ",
+			arr:    "YSSY",
+			rte:    "ECHO FOXTR",
+			points: []string{"fix:ECHO", "fix:FOXTR", "airport:YSSY"},
+		},
+		{
+			name:       "unknown fix",
+			dep:        "EGLL",
+			arr:        "EHAM",
+			rte:        "BPK7G ALPHA DELTA",
+			points:     []string{"airport:EGLL", "fix:ALPHA", "fix:DELTA", "airport:EHAM"},
+			unresolved: []string{"BPK7G"},
+		},
+	}
+
+	e := testExpander()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := e.Expand(tc.dep, tc.arr, tc.rte)
+			if got := names(r); !reflect.DeepEqual(got, tc.points) {
+				t.Fatalf("expected points %v, got %v", tc.points, got)
+			}
+			unresolved := tc.unresolved
+			if unresolved == nil {
+				unresolved = []string{}
+			}
+			if !reflect.DeepEqual(r.Unresolved, unresolved) {
+				t.Fatalf("expected unresolved %v, got %v", unresolved, r.Unresolved)
+			}
+		})
+	}
+}
+
+func TestExpandNearestFix(t *testing.T) {
+	e := testExpander()
+
+	r := e.Expand("EGLL", "EHAM", "ECHO")
+	if echo := r.Points[1]; echo.Lat != 51 || echo.Lng != 4 {
+		t.Fatalf("expected ECHO near London, got %v, %v", echo.Lat, echo.Lng)
+	}
+
+	r = e.Expand("YSSY", "YSSY", "ECHO")
+	if echo := r.Points[1]; echo.Lat != -33 || echo.Lng != 151 {
+		t.Fatalf("expected ECHO near Sydney, got %v, %v", echo.Lat, echo.Lng)
+	}
+
+	// the departure is unknown, the arrival is the reference
+	r = e.Expand("ZZZZ", "YSSY", "ECHO")
+	if echo := r.Points[0]; echo.Lat != -33 || echo.Lng != 151 {
+		t.Fatalf("expected ECHO near Sydney, got %v, %v", echo.Lat, echo.Lng)
+	}
+}
@@ -8,26 +8,48 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/mqtt"
 	"github.com/vatsimnerd/simwatch/provider"
+	"github.com/vatsimnerd/simwatch/stats"
+	"github.com/vatsimnerd/simwatch/webhook"
 )
 
 type Server struct {
 	provider *provider.Provider
+	webhooks config.WebhooksConfig
+	hooks    *webhook.Dispatcher
+	mqttCfg  config.MQTTConfig
+	mqtt     *mqtt.Publisher
+	statsCfg config.StatsConfig
+	stats    *stats.Collector
 	srv      *http.Server
 	addr     string
 	cors     bool
+
+	statusInterval time.Duration
+	heatmapRefresh time.Duration
 }
 
 var (
 	log = logrus.WithField("module", "server")
 )
 
-func NewServer(cfg *config.Config) *Server {
+func NewServer(cfg *config.Config) (*Server, error) {
+	prov, err := provider.New(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &Server{
-		provider: provider.New(cfg),
+		provider: prov,
+		webhooks: cfg.Webhooks,
+		mqttCfg:  cfg.MQTT,
+		statsCfg: cfg.Stats,
 		addr:     cfg.Web.Addr,
 		cors:     cfg.Web.CORS,
-	}
+
+		statusInterval: cfg.Freshness.StatusInterval,
+		heatmapRefresh: cfg.Heatmap.HistoryRefresh,
+	}, nil
 }
 
 func (s *Server) Start() error {
@@ -35,16 +57,51 @@ func (s *Server) Start() error {
 	l.Info("starting simwatch provider")
 	s.provider.Start()
 
+	hooks, err := webhook.New(s.webhooks)
+	if err != nil {
+		l.WithError(err).Error("error configuring webhooks")
+		return err
+	}
+	s.hooks = hooks
+	s.hooks.Start(s.provider)
+
+	if s.mqttCfg.Enabled {
+		l.Info("starting mqtt publisher")
+		pub := mqtt.New(s.mqttCfg)
+		err = pub.Start(s.provider)
+		if err != nil {
+			// mqtt is an optional feature, keep serving without it
+			l.WithError(err).Error("error starting mqtt publisher")
+		} else {
+			s.mqtt = pub
+		}
+	}
+
+	if s.statsCfg.Enabled {
+		l.Info("starting stats collector")
+		s.stats = stats.New(s.statsCfg)
+		s.stats.Start(s.provider)
+	}
+
 	l.Info("setting up router")
 	router := mux.NewRouter()
 	if s.cors {
 		router.Use(applyCors)
 	}
 	router.HandleFunc("/api/updates", s.handleApiUpdates).Methods("GET")
+	router.HandleFunc("/api/events", s.handleApiEvents).Methods("GET")
+	router.HandleFunc("/api/replay", s.handleApiReplay).Methods("GET")
 	router.HandleFunc("/api/pilots", s.handleApiPilots).Methods("GET")
 	router.HandleFunc("/api/pilots/{id}", s.handleApiPilotsGet).Methods("GET")
 	router.HandleFunc("/api/airports", s.handleApiAirports).Methods("GET")
 	router.HandleFunc("/api/airports/{id}", s.handleApiAirportsGet).Methods("GET")
+	router.HandleFunc("/api/airports/{id}/board", s.handleApiAirportsBoard).Methods("GET")
+	router.HandleFunc("/api/conflicts", s.handleApiConflicts).Methods("GET")
+	router.HandleFunc("/api/firs", s.handleApiFIRs).Methods("GET")
+	router.HandleFunc("/api/firs/coverage", s.handleApiFIRsCoverage).Methods("GET")
+	router.HandleFunc("/api/status", s.handleApiStatus).Methods("GET")
+	router.HandleFunc("/api/heatmap", s.handleApiHeatmap).Methods("GET")
+	router.HandleFunc("/api/stats", s.handleApiStats).Methods("GET")
 	router.HandleFunc("/api/__build", buildInfo).Methods("GET")
 
 	l.WithField("addr", s.addr).Info("creating http server")
@@ -59,6 +116,18 @@ func (s *Server) Start() error {
 
 func (s *Server) Stop() error {
 	l := log.WithField("func", "Stop")
+	if s.hooks != nil {
+		l.Info("stopping webhook dispatcher")
+		s.hooks.Stop()
+	}
+	if s.mqtt != nil {
+		l.Info("stopping mqtt publisher")
+		s.mqtt.Stop()
+	}
+	if s.stats != nil {
+		l.Info("stopping stats collector")
+		s.stats.Stop()
+	}
 	l.Info("stopping http server")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
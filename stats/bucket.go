@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+type (
+	// Gauge summarizes values sampled within a point's interval
+	Gauge struct {
+		Avg float64 `json:"avg"`
+		Min int     `json:"min"`
+		Max int     `json:"max"`
+	}
+
+	// Count is a ranking entry, an airport or an aircraft type
+	Count struct {
+		Key   string  `json:"key"`
+		Count float64 `json:"count"`
+	}
+
+	// Point is a series value over [TS, TS + resolution). Movements are
+	// takeoffs and landings within the interval, aircraft types are
+	// ranked by the average number of pilots flying them.
+	Point struct {
+		TS              time.Time        `json:"ts"`
+		Samples         int              `json:"samples"`
+		Pilots          Gauge            `json:"pilots"`
+		Controllers     map[string]Gauge `json:"controllers"`
+		Movements       int              `json:"movements"`
+		BusiestAirports []Count          `json:"busiest_airports"`
+		AircraftTypes   []Count          `json:"aircraft_types"`
+	}
+
+	// bucket accumulates samples of an open point, fields are
+	// exported to be saved with series
+	bucket struct {
+		TS            time.Time            `json:"ts"`
+		Samples       int                  `json:"samples"`
+		Pilots        gaugeAcc             `json:"pilots"`
+		Controllers   map[string]*gaugeAcc `json:"controllers"`
+		Movements     map[string]int       `json:"movements"`
+		AircraftTypes map[string]int       `json:"aircraft_types"`
+	}
+
+	gaugeAcc struct {
+		Sum int `json:"sum"`
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+)
+
+func newBucket(ts time.Time) *bucket {
+	return &bucket{
+		TS:            ts,
+		Controllers:   make(map[string]*gaugeAcc),
+		Movements:     make(map[string]int),
+		AircraftTypes: make(map[string]int),
+	}
+}
+
+func (b *bucket) add(nc provider.NetworkCounts, movements map[string]int) {
+	first := b.Samples == 0
+	b.Samples++
+
+	b.Pilots.add(nc.Pilots, first)
+	// facilities nobody is online at are sampled as zeros
+	// so averages and minimums stay honest
+	for _, name := range provider.FacilityNames() {
+		acc, found := b.Controllers[name]
+		if !found {
+			acc = &gaugeAcc{}
+			b.Controllers[name] = acc
+		}
+		acc.add(nc.Controllers[name], first)
+	}
+	for icao, count := range movements {
+		b.Movements[icao] += count
+	}
+	for tp, count := range nc.AircraftTypes {
+		b.AircraftTypes[tp] += count
+	}
+}
+
+func (b *bucket) point(topN int) Point {
+	pt := Point{
+		TS:          b.TS,
+		Samples:     b.Samples,
+		Pilots:      b.Pilots.gauge(b.Samples),
+		Controllers: make(map[string]Gauge, len(b.Controllers)),
+	}
+	for name, acc := range b.Controllers {
+		pt.Controllers[name] = acc.gauge(b.Samples)
+	}
+
+	pt.BusiestAirports = make([]Count, 0, len(b.Movements))
+	for icao, count := range b.Movements {
+		pt.Movements += count
+		pt.BusiestAirports = append(pt.BusiestAirports, Count{Key: icao, Count: float64(count)})
+	}
+	pt.BusiestAirports = top(pt.BusiestAirports, topN)
+
+	pt.AircraftTypes = make([]Count, 0, len(b.AircraftTypes))
+	for tp, count := range b.AircraftTypes {
+		pt.AircraftTypes = append(pt.AircraftTypes, Count{Key: tp, Count: average(count, b.Samples)})
+	}
+	pt.AircraftTypes = top(pt.AircraftTypes, topN)
+	return pt
+}
+
+func (g *gaugeAcc) add(value int, first bool) {
+	g.Sum += value
+	if first || value < g.Min {
+		g.Min = value
+	}
+	if first || value > g.Max {
+		g.Max = value
+	}
+}
+
+func (g *gaugeAcc) gauge(samples int) Gauge {
+	return Gauge{Avg: average(g.Sum, samples), Min: g.Min, Max: g.Max}
+}
+
+func average(sum int, samples int) float64 {
+	if samples == 0 {
+		return 0
+	}
+	return math.Round(float64(sum)/float64(samples)*100) / 100
+}
+
+func top(counts []Count, n int) []Count {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
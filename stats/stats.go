@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+type Resolution string
+
+const (
+	ResolutionMinute Resolution = "1m"
+	ResolutionHour   Resolution = "1h"
+	ResolutionDay    Resolution = "1d"
+)
+
+var (
+	log = logrus.WithField("module", "stats")
+
+	ErrInvalidResolution = fmt.Errorf("invalid resolution")
+
+	resolutions = []Resolution{ResolutionMinute, ResolutionHour, ResolutionDay}
+	steps       = map[Resolution]time.Duration{
+		ResolutionMinute: time.Minute,
+		ResolutionHour:   time.Hour,
+		ResolutionDay:    24 * time.Hour,
+	}
+)
+
+// series keeps closed points of a rollup and the open bucket
+// collecting samples of the current interval
+type series struct {
+	Points []Point `json:"points"`
+	Open   *bucket `json:"open"`
+	step   time.Duration
+	keep   time.Duration
+}
+
+// Collector samples network statistics after every provider data cycle
+type Collector struct {
+	cfg    config.StatsConfig
+	series map[Resolution]*series
+	lock   sync.RWMutex
+
+	// movements counted since the previous sample
+	movements map[string]int
+	mvLock    sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(cfg config.StatsConfig) *Collector {
+	keep := map[Resolution]time.Duration{
+		ResolutionMinute: cfg.Retention.Minute,
+		ResolutionHour:   cfg.Retention.Hour,
+		ResolutionDay:    cfg.Retention.Day,
+	}
+
+	c := &Collector{
+		cfg:       cfg,
+		series:    make(map[Resolution]*series),
+		movements: make(map[string]int),
+		stop:      make(chan struct{}),
+	}
+	for _, res := range resolutions {
+		c.series[res] = &series{Points: make([]Point, 0), step: steps[res], keep: keep[res]}
+	}
+	return c
+}
+
+// Start loads previously saved series and starts sampling
+func (c *Collector) Start(prov *provider.Provider) {
+	l := log.WithFields(logrus.Fields{
+		"func": "Start",
+		"path": c.cfg.Path,
+	})
+
+	err := c.load()
+	if err != nil && !os.IsNotExist(err) {
+		// statistics start over, that's not a reason to refuse starting
+		l.WithError(err).Error("error loading stats")
+	}
+
+	events := prov.SubscribeEvents(1024, provider.EventTakeoff, provider.EventLanding)
+	c.wg.Add(2)
+	go c.countMovements(prov, events)
+	go c.loop(prov)
+}
+
+func (c *Collector) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+	if err := c.save(); err != nil {
+		log.WithError(err).WithField("func", "Stop").Error("error saving stats")
+	}
+}
+
+func (c *Collector) loop(prov *provider.Provider) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.SaveInterval)
+	defer ticker.Stop()
+
+	next := prov.NextCycle()
+	for {
+		select {
+		case <-next:
+			next = prov.NextCycle()
+			c.sample(prov.NetworkCounts(), time.Now())
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				log.WithError(err).WithField("func", "loop").Error("error saving stats")
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Collector) countMovements(prov *provider.Provider, events *provider.EventSubscription) {
+	defer c.wg.Done()
+	defer prov.UnsubscribeEvents(events)
+
+	for {
+		select {
+		case event, ok := <-events.Events():
+			if !ok {
+				return
+			}
+			c.mvLock.Lock()
+			c.movements[event.Airport]++
+			c.mvLock.Unlock()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Collector) sample(nc provider.NetworkCounts, now time.Time) {
+	c.mvLock.Lock()
+	movements := c.movements
+	c.movements = make(map[string]int)
+	c.mvLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, res := range resolutions {
+		s := c.series[res]
+		ts := now.Truncate(s.step)
+		if s.Open != nil && !s.Open.TS.Equal(ts) {
+			s.Points = append(s.Points, s.Open.point(c.cfg.TopN))
+			s.Open = nil
+		}
+		if s.Open == nil {
+			s.Open = newBucket(ts)
+		}
+		s.Open.add(nc, movements)
+		s.expire(now)
+	}
+}
+
+func (s *series) expire(now time.Time) {
+	i := 0
+	for i < len(s.Points) && now.Sub(s.Points[i].TS) > s.keep {
+		i++
+	}
+	if i > 0 {
+		s.Points = append(s.Points[:0:0], s.Points[i:]...)
+	}
+}
+
+// Series returns points within [from, to], the current
+// interval is included as a partial point
+func (c *Collector) Series(res Resolution, from time.Time, to time.Time) ([]Point, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	s, found := c.series[res]
+	if !found {
+		return nil, ErrInvalidResolution
+	}
+
+	points := make([]Point, 0)
+	for _, pt := range s.Points {
+		if !pt.TS.Before(from) && !pt.TS.After(to) {
+			points = append(points, pt)
+		}
+	}
+	if s.Open != nil && !s.Open.TS.Before(from) && !s.Open.TS.After(to) {
+		points = append(points, s.Open.point(c.cfg.TopN))
+	}
+	return points, nil
+}
@@ -0,0 +1,70 @@
+package stats
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+func (c *Collector) save() error {
+	c.lock.RLock()
+	data, err := json.Marshal(c.series)
+	c.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// a crash while writing must never break saved stats
+	tmp := c.cfg.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write(data)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.cfg.Path)
+}
+
+func (c *Collector) load() error {
+	f, err := os.Open(c.cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	saved := make(map[Resolution]*series)
+	err = json.NewDecoder(gz).Decode(&saved)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for res, s := range c.series {
+		if ss, found := saved[res]; found && ss.Points != nil {
+			s.Points = ss.Points
+			s.Open = ss.Open
+			s.expire(now)
+		}
+	}
+	return nil
+}
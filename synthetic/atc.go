@@ -0,0 +1,133 @@
+package synthetic
+
+import (
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+const (
+	// share of positions opened as FIR radars
+	radarShare = 0.2
+)
+
+var (
+	airportFacilities = []vatsimapi.Facility{
+		vatsimapi.FacilityATIS,
+		vatsimapi.FacilityDelivery,
+		vatsimapi.FacilityGround,
+		vatsimapi.FacilityTower,
+		vatsimapi.FacilityApproach,
+	}
+	facilitySuffixes = map[vatsimapi.Facility]string{
+		vatsimapi.FacilityATIS:     "ATIS",
+		vatsimapi.FacilityDelivery: "DEL",
+		vatsimapi.FacilityGround:   "GND",
+		vatsimapi.FacilityTower:    "TWR",
+		vatsimapi.FacilityApproach: "APP",
+		vatsimapi.FacilityRadar:    "CTR",
+	}
+)
+
+// position is an open controller position, either at an airport
+// or covering a FIR
+type position struct {
+	ctrl vatsimapi.Controller
+	icao string
+	fir  *vatspydata.FIR
+}
+
+func (g *Generator) openPosition(now time.Time) (pubsub.Update, bool) {
+	if len(g.firs) > 0 && g.rnd.Float64() < radarShare {
+		for attempt := 0; attempt < 10; attempt++ {
+			fir := g.firs[g.rnd.Intn(len(g.firs))]
+			callsign := fir.ID + "_CTR"
+			if _, exists := g.positions[callsign]; exists {
+				continue
+			}
+			pos := &position{ctrl: g.makeController(callsign, vatsimapi.FacilityRadar, now), fir: &fir}
+			g.positions[callsign] = pos
+			radar := merged.Radar{
+				Controller: pos.ctrl,
+				FIRs:       map[string]vatspydata.FIR{fir.ID: fir},
+			}
+			return pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypeRadar, Obj: radar}, true
+		}
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		meta := g.pickAirport()
+		facility := airportFacilities[g.rnd.Intn(len(airportFacilities))]
+		callsign := meta.ICAO + "_" + facilitySuffixes[facility]
+		if _, exists := g.positions[callsign]; exists {
+			continue
+		}
+		pos := &position{ctrl: g.makeController(callsign, facility, now), icao: meta.ICAO}
+		g.positions[callsign] = pos
+		return g.airportUpdate(meta.ICAO), true
+	}
+	return pubsub.Update{}, false
+}
+
+func (g *Generator) closePosition(now time.Time) (pubsub.Update, bool) {
+	for callsign, pos := range g.positions {
+		delete(g.positions, callsign)
+		if pos.fir != nil {
+			radar := merged.Radar{
+				Controller: pos.ctrl,
+				FIRs:       map[string]vatspydata.FIR{pos.fir.ID: *pos.fir},
+			}
+			return pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: merged.ObjectTypeRadar, Obj: radar}, true
+		}
+		return g.airportUpdate(pos.icao), true
+	}
+	return pubsub.Update{}, false
+}
+
+// airportUpdate rebuilds an airport's controller set from open positions
+func (g *Generator) airportUpdate(icao string) pubsub.Update {
+	arpt := merged.Airport{
+		Meta:    g.metas[icao],
+		Runways: make(map[string]*ourairports.Runway),
+	}
+	for _, facility := range airportFacilities {
+		pos, found := g.positions[icao+"_"+facilitySuffixes[facility]]
+		if !found {
+			continue
+		}
+		ctrl := pos.ctrl
+		switch facility {
+		case vatsimapi.FacilityATIS:
+			arpt.Controllers.ATIS = &ctrl
+		case vatsimapi.FacilityDelivery:
+			arpt.Controllers.Delivery = &ctrl
+		case vatsimapi.FacilityGround:
+			arpt.Controllers.Ground = &ctrl
+		case vatsimapi.FacilityTower:
+			arpt.Controllers.Tower = &ctrl
+		case vatsimapi.FacilityApproach:
+			arpt.Controllers.Approach = &ctrl
+		}
+	}
+	return pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypeAirport, Obj: arpt}
+}
+
+func (g *Generator) makeController(callsign string, facility vatsimapi.Facility, now time.Time) vatsimapi.Controller {
+	g.nextCID++
+	return vatsimapi.Controller{
+		Cid:         g.nextCID,
+		Name:        "Synthetic Controller",
+		Callsign:    callsign,
+		Frequency:   118 + float64(g.rnd.Intn(800))*0.025,
+		Facility:    facility,
+		Rating:      3,
+		Server:      "SYNTHETIC",
+		VisualRange: 100,
+		LastUpdated: now,
+		LogonTime:   now,
+	}
+}
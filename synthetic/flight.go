@@ -0,0 +1,162 @@
+package synthetic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	vatsimapi "github.com/vatsimnerd/simwatch-providers/vatsim-api"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+const (
+	minRouteNM = 100
+	maxRouteNM = 3500
+
+	// flight numbers go from 1 to that for every airline
+	maxFlightNumber = 9999
+	// random callsigns are tried that many times before
+	// free ones are looked for in order
+	callsignAttempts = 100
+
+	// roughly a 3 degree slope
+	feetPerNM  = 320
+	taxiGS     = 15
+	approachGS = 140
+)
+
+var (
+	airlines = []string{"AFL", "BAW", "DLH", "AFR", "UAL", "DAL", "AAL", "KLM", "RYR", "EZY", "SIA", "QFA", "UAE", "THY"}
+	aircraft = []string{"A320", "A321", "A20N", "B738", "B38M", "A359", "B77W", "B789", "E190", "A388"}
+)
+
+type flightPhase int
+
+const (
+	phaseTaxiOut flightPhase = iota
+	phaseAirborne
+	phaseLanded
+)
+
+type flight struct {
+	cid       int
+	callsign  string
+	aircraft  string
+	squawk    string
+	dep       vatspydata.AirportMeta
+	arr       vatspydata.AirportMeta
+	routeNM   float64
+	flownNM   float64
+	cruiseAlt int
+	cruiseGS  int
+	phase     flightPhase
+	logonTime time.Time
+
+	lat float64
+	lng float64
+	alt int
+	gs  int
+	hdg int
+}
+
+func newFlight(rnd *rand.Rand, cid int, callsign string, dep, arr vatspydata.AirportMeta, now time.Time) *flight {
+	f := &flight{
+		cid:       cid,
+		callsign:  callsign,
+		aircraft:  aircraft[rnd.Intn(len(aircraft))],
+		squawk:    fmt.Sprintf("%d%d%d%d", rnd.Intn(8), rnd.Intn(8), rnd.Intn(8), rnd.Intn(8)),
+		dep:       dep,
+		arr:       arr,
+		routeNM:   geo.DistanceNM(dep.Position.Lat, dep.Position.Lng, arr.Position.Lat, arr.Position.Lng),
+		cruiseAlt: 28000 + rnd.Intn(12)*1000,
+		cruiseGS:  420 + rnd.Intn(80),
+		phase:     phaseTaxiOut,
+		logonTime: now,
+		lat:       dep.Position.Lat,
+		lng:       dep.Position.Lng,
+	}
+	f.hdg = int(geo.Bearing(dep.Position.Lat, dep.Position.Lng, arr.Position.Lat, arr.Position.Lng))
+	return f
+}
+
+// advance moves the flight along its route, it returns false
+// once the flight is over and the pilot should disconnect
+func (f *flight) advance(dt time.Duration) bool {
+	switch f.phase {
+	case phaseTaxiOut:
+		f.gs = taxiGS
+		f.phase = phaseAirborne
+		return true
+	case phaseLanded:
+		return false
+	}
+
+	f.flownNM += float64(f.gs) * dt.Hours()
+	if f.flownNM >= f.routeNM {
+		f.flownNM = f.routeNM
+		f.phase = phaseLanded
+	}
+	f.updatePosition()
+	return true
+}
+
+// setProgress places the flight at a given fraction of its route,
+// used to populate the sky at startup
+func (f *flight) setProgress(fraction float64) {
+	f.phase = phaseAirborne
+	f.flownNM = f.routeNM * fraction
+	f.updatePosition()
+}
+
+func (f *flight) updatePosition() {
+	fraction := f.flownNM / f.routeNM
+	f.lat, f.lng = geo.Intermediate(f.dep.Position.Lat, f.dep.Position.Lng, f.arr.Position.Lat, f.arr.Position.Lng, fraction)
+	if f.phase != phaseLanded {
+		f.hdg = int(geo.Bearing(f.lat, f.lng, f.arr.Position.Lat, f.arr.Position.Lng))
+	}
+
+	toGo := f.routeNM - f.flownNM
+	alt := math.Min(float64(f.cruiseAlt), math.Min(f.flownNM, toGo)*feetPerNM)
+	f.alt = int(alt)
+
+	if f.phase == phaseLanded {
+		f.alt = 0
+		f.gs = 0
+		return
+	}
+	// accelerate with altitude from approach to cruise speed
+	f.gs = approachGS + int(float64(f.cruiseGS-approachGS)*alt/float64(f.cruiseAlt))
+}
+
+func (f *flight) pilot(now time.Time) merged.Pilot {
+	return merged.Pilot{
+		Pilot: vatsimapi.Pilot{
+			Cid:         f.cid,
+			Name:        "Synthetic Pilot",
+			Callsign:    f.callsign,
+			Server:      "SYNTHETIC",
+			Latitude:    f.lat,
+			Longitude:   f.lng,
+			Altitude:    f.alt,
+			Groundspeed: f.gs,
+			Heading:     f.hdg,
+			Transponder: f.squawk,
+			QnhIHg:      29.92,
+			QnhMb:       1013,
+			FlightPlan: &vatsimapi.FlightPlan{
+				FlightRules: "I",
+				Aircraft:    f.aircraft,
+				Departure:   f.dep.ICAO,
+				Arrival:     f.arr.ICAO,
+				CruiseTas:   fmt.Sprintf("%d", f.cruiseGS),
+				Altitude:    fmt.Sprintf("%d", f.cruiseAlt),
+				Route:       "DCT",
+			},
+			LogonTime:   f.logonTime,
+			LastUpdated: now,
+		},
+	}
+}
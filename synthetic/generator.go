@@ -0,0 +1,366 @@
+package synthetic
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch-providers/ourairports"
+	vatspydata "github.com/vatsimnerd/simwatch-providers/vatspy-data"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/geo"
+	"github.com/vatsimnerd/util/pubsub"
+)
+
+var (
+	log = logrus.WithField("module", "synthetic")
+)
+
+// Generator is a provider source producing fake traffic. Pilots fly
+// great circle routes between real airports taken from vatspy data,
+// controllers open and close airport and FIR positions.
+type Generator struct {
+	*pubsub.Provider
+	cfg     config.SyntheticSourceConfig
+	dataCfg *vatspydata.Config
+	rnd     *rand.Rand
+
+	airportMetas []vatspydata.AirportMeta
+	metas        map[string]vatspydata.AirportMeta
+	firs         []vatspydata.FIR
+	flights      map[string]*flight
+	positions    map[string]*position
+	nextCID      int
+
+	// emitted state, read by the initial notifier
+	airports map[string]merged.Airport
+	pilots   map[string]merged.Pilot
+	radars   map[string]merged.Radar
+	dataLock sync.RWMutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func New(cfg config.SyntheticSourceConfig, dataCfg *vatspydata.Config) *Generator {
+	// every pilot needs a unique callsign
+	if maxPilots := len(airlines) * maxFlightNumber; cfg.Pilots > maxPilots {
+		log.WithFields(logrus.Fields{
+			"pilots":     cfg.Pilots,
+			"max_pilots": maxPilots,
+		}).Warn("too many pilots requested, limiting")
+		cfg.Pilots = maxPilots
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Generator{
+		Provider:  pubsub.NewProvider(),
+		cfg:       cfg,
+		dataCfg:   dataCfg,
+		rnd:       rand.New(rand.NewSource(seed)),
+		metas:     make(map[string]vatspydata.AirportMeta),
+		flights:   make(map[string]*flight),
+		positions: make(map[string]*position),
+		nextCID:   800000,
+		airports:  make(map[string]merged.Airport),
+		pilots:    make(map[string]merged.Pilot),
+		radars:    make(map[string]merged.Radar),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (g *Generator) Start() error {
+	if g.cfg.UpdatePeriod <= 0 {
+		return fmt.Errorf("invalid update period %v", g.cfg.UpdatePeriod)
+	}
+
+	g.SetInitialNotifier(func(sub pubsub.Subscription) {
+		// same as merged provider does, don't block subscribe
+		go func() {
+			g.dataLock.RLock()
+			defer g.dataLock.RUnlock()
+			for _, arpt := range g.airports {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypeAirport, Obj: arpt})
+			}
+			for _, pilot := range g.pilots {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypePilot, Obj: pilot})
+			}
+			for _, radar := range g.radars {
+				sub.Send(pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypeRadar, Obj: radar})
+			}
+			sub.Send(pubsub.Update{UType: pubsub.UpdateTypeFin})
+		}()
+	})
+
+	go g.loop()
+	return nil
+}
+
+func (g *Generator) Stop() {
+	close(g.stop)
+	<-g.done
+}
+
+func (g *Generator) loop() {
+	defer close(g.done)
+
+	if !g.loadStaticData() {
+		return
+	}
+	if len(g.airportMetas) < 2 {
+		log.Error("not enough airports to generate traffic")
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"airports": len(g.airportMetas),
+		"firs":     len(g.firs),
+		"pilots":   g.cfg.Pilots,
+	}).Info("static data loaded, generating traffic")
+
+	g.initialize()
+
+	t := time.NewTicker(g.cfg.UpdatePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			g.tick()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// loadStaticData waits for the first complete vatspy data set
+func (g *Generator) loadStaticData() bool {
+	static := vatspydata.New(g.dataCfg)
+	ssub := static.Subscribe(32768)
+	defer static.Unsubscribe(ssub)
+	static.Start()
+	defer static.Stop()
+
+	for {
+		select {
+		case upd := <-ssub.Updates():
+			switch upd.UType {
+			case pubsub.UpdateTypeFin:
+				return true
+			case pubsub.UpdateTypeSet:
+				switch obj := upd.Obj.(type) {
+				case vatspydata.AirportMeta:
+					if !obj.IsPseudo {
+						g.airportMetas = append(g.airportMetas, obj)
+						g.metas[obj.ICAO] = obj
+					}
+				case vatspydata.FIR:
+					g.firs = append(g.firs, obj)
+				}
+			}
+		case <-g.stop:
+			return false
+		}
+	}
+}
+
+func (g *Generator) initialize() {
+	now := time.Now()
+	updates := make([]pubsub.Update, 0, len(g.airportMetas)+g.cfg.Pilots)
+
+	for _, meta := range g.airportMetas {
+		arpt := merged.Airport{Meta: meta, Runways: make(map[string]*ourairports.Runway)}
+		updates = append(updates, pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypeAirport, Obj: arpt})
+	}
+
+	for i := 0; i < g.cfg.Pilots; i++ {
+		f := g.spawnFlight(now)
+		if f == nil {
+			continue
+		}
+		// spread initial flights along their routes
+		f.setProgress(g.rnd.Float64())
+		updates = append(updates, g.pilotUpdate(f, now))
+	}
+
+	for len(g.positions) < g.cfg.Controllers {
+		upd, ok := g.openPosition(now)
+		if !ok {
+			break
+		}
+		updates = append(updates, upd)
+	}
+
+	g.emit(updates)
+	g.SetDataReady(true)
+}
+
+func (g *Generator) tick() {
+	now := time.Now()
+	updates := make([]pubsub.Update, 0, len(g.flights))
+
+	for callsign, f := range g.flights {
+		if f.advance(g.cfg.UpdatePeriod) {
+			updates = append(updates, g.pilotUpdate(f, now))
+			continue
+		}
+		delete(g.flights, callsign)
+		updates = append(updates, pubsub.Update{UType: pubsub.UpdateTypeDelete, OType: merged.ObjectTypePilot, Obj: f.pilot(now)})
+	}
+
+	for len(g.flights) < g.cfg.Pilots {
+		f := g.spawnFlight(now)
+		if f == nil {
+			break
+		}
+		updates = append(updates, g.pilotUpdate(f, now))
+	}
+
+	churn := int(float64(g.cfg.Controllers)*g.cfg.ControllerChurn + g.rnd.Float64())
+	for i := 0; i < churn; i++ {
+		upd, ok := g.closePosition(now)
+		if ok {
+			updates = append(updates, upd)
+		}
+	}
+	for len(g.positions) < g.cfg.Controllers {
+		upd, ok := g.openPosition(now)
+		if !ok {
+			break
+		}
+		updates = append(updates, upd)
+	}
+
+	g.emit(updates)
+}
+
+// emit notifies subscribers keeping the state in sync for
+// late subscribers, every batch ends with fin like merged's do
+func (g *Generator) emit(updates []pubsub.Update) {
+	g.dataLock.Lock()
+	defer g.dataLock.Unlock()
+
+	for _, upd := range updates {
+		switch obj := upd.Obj.(type) {
+		case merged.Airport:
+			g.airports[obj.Meta.ICAO] = obj
+		case merged.Pilot:
+			if upd.UType == pubsub.UpdateTypeDelete {
+				delete(g.pilots, obj.Callsign)
+			} else {
+				g.pilots[obj.Callsign] = obj
+			}
+		case merged.Radar:
+			if upd.UType == pubsub.UpdateTypeDelete {
+				delete(g.radars, obj.Controller.Callsign)
+			} else {
+				g.radars[obj.Controller.Callsign] = obj
+			}
+		}
+		g.Notify(upd)
+	}
+	g.Fin()
+}
+
+func (g *Generator) pilotUpdate(f *flight, now time.Time) pubsub.Update {
+	return pubsub.Update{UType: pubsub.UpdateTypeSet, OType: merged.ObjectTypePilot, Obj: f.pilot(now)}
+}
+
+func (g *Generator) spawnFlight(now time.Time) *flight {
+	dep := g.pickAirport()
+	for attempt := 0; attempt < 20; attempt++ {
+		arr := g.pickAirport()
+		dist := geo.DistanceNM(dep.Position.Lat, dep.Position.Lng, arr.Position.Lat, arr.Position.Lng)
+		if dist < minRouteNM || dist > maxRouteNM {
+			continue
+		}
+
+		callsign, ok := g.makeCallsign()
+		if !ok {
+			return nil
+		}
+		g.nextCID++
+		f := newFlight(g.rnd, g.nextCID, callsign, dep, arr, now)
+		g.flights[callsign] = f
+		return f
+	}
+	return nil
+}
+
+// makeCallsign picks a random unused callsign, with most of them
+// taken the first unused one is returned. It fails only if there are
+// no callsigns left.
+func (g *Generator) makeCallsign() (string, bool) {
+	for attempt := 0; attempt < callsignAttempts; attempt++ {
+		callsign := fmt.Sprintf("%s%d", airlines[g.rnd.Intn(len(airlines))], 1+g.rnd.Intn(maxFlightNumber))
+		if _, exists := g.flights[callsign]; !exists {
+			return callsign, true
+		}
+	}
+	for _, airline := range airlines {
+		for number := 1; number <= maxFlightNumber; number++ {
+			callsign := fmt.Sprintf("%s%d", airline, number)
+			if _, exists := g.flights[callsign]; !exists {
+				return callsign, true
+			}
+		}
+	}
+	return "", false
+}
+
+// pickAirport picks a random airport, a HotspotShare of picks are
+// made within hotspots chosen according to their weights
+func (g *Generator) pickAirport() vatspydata.AirportMeta {
+	if len(g.cfg.Hotspots) > 0 && g.rnd.Float64() < g.cfg.HotspotShare {
+		hs := g.pickHotspot()
+		for attempt := 0; attempt < 50; attempt++ {
+			meta := g.airportMetas[g.rnd.Intn(len(g.airportMetas))]
+			if geo.DistanceNM(hs.Lat, hs.Lng, meta.Position.Lat, meta.Position.Lng) <= hs.RadiusNM {
+				return meta
+			}
+		}
+		// the hotspot is too sparse for random sampling, fall back
+		// to the nearest airport
+		return g.nearestAirport(hs.Lat, hs.Lng)
+	}
+	return g.airportMetas[g.rnd.Intn(len(g.airportMetas))]
+}
+
+func (g *Generator) pickHotspot() config.Hotspot {
+	total := 0.0
+	for _, hs := range g.cfg.Hotspots {
+		total += hs.Weight
+	}
+	if total <= 0 {
+		return g.cfg.Hotspots[g.rnd.Intn(len(g.cfg.Hotspots))]
+	}
+
+	r := g.rnd.Float64() * total
+	for _, hs := range g.cfg.Hotspots {
+		r -= hs.Weight
+		if r <= 0 {
+			return hs
+		}
+	}
+	return g.cfg.Hotspots[len(g.cfg.Hotspots)-1]
+}
+
+func (g *Generator) nearestAirport(lat, lng float64) vatspydata.AirportMeta {
+	nearest := g.airportMetas[0]
+	minDist := geo.DistanceNM(lat, lng, nearest.Position.Lat, nearest.Position.Lng)
+	for _, meta := range g.airportMetas[1:] {
+		dist := geo.DistanceNM(lat, lng, meta.Position.Lat, meta.Position.Lng)
+		if dist < minDist {
+			minDist = dist
+			nearest = meta
+		}
+	}
+	return nearest
+}
@@ -0,0 +1,153 @@
+package track
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Archive format is a gzipped stream of JSON lines. The first line is
+// an archiveHeader, every next one is an archiveRecord holding a whole
+// track. It doesn't depend on any track engine so it can be used both
+// for backups and for moving tracks between engines.
+
+const (
+	archiveFormat  = "simwatch-tracks"
+	archiveVersion = 1
+
+	// archive lines may be huge for long flights
+	maxArchiveLineSize = 64 * 1024 * 1024
+)
+
+type archiveHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type archiveRecord struct {
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Points    []TrackPoint `json:"points"`
+}
+
+// Copy reads every track from src and imports it to dst.
+// It returns the number of tracks copied.
+func Copy(ctx context.Context, src TrackReadWriter, dst TrackReadWriter) (int, error) {
+	l := log.WithField("func", "Copy")
+
+	ids, err := src.ListIDs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing tracks: %w", err)
+	}
+
+	count := 0
+	for _, id := range ids {
+		t, err := src.LoadTrackByID(ctx, id)
+		if err != nil {
+			// the track might have been garbage-collected
+			l.WithField("track_id", id).WithError(err).Error("error loading track, skipping")
+			continue
+		}
+
+		err = dst.ImportTrack(ctx, id, t)
+		if err != nil {
+			return count, fmt.Errorf("error importing track %s: %w", id, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Dump writes every track from src to w in archive format.
+// It returns the number of tracks written.
+func Dump(ctx context.Context, src TrackReadWriter, w io.Writer) (int, error) {
+	l := log.WithField("func", "Dump")
+
+	ids, err := src.ListIDs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing tracks: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	err = enc.Encode(archiveHeader{
+		Format:    archiveFormat,
+		Version:   archiveVersion,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		t, err := src.LoadTrackByID(ctx, id)
+		if err != nil {
+			l.WithField("track_id", id).WithError(err).Error("error loading track, skipping")
+			continue
+		}
+
+		err = enc.Encode(archiveRecord{ID: id, CreatedAt: t.CreatedAt, Points: t.Points})
+		if err != nil {
+			return count, fmt.Errorf("error writing track %s: %w", id, err)
+		}
+		count++
+	}
+
+	return count, gz.Close()
+}
+
+// Restore reads tracks in archive format from r and imports them to dst.
+// It returns the number of tracks imported.
+func Restore(ctx context.Context, r io.Reader, dst TrackReadWriter) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("error reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 0, 64*1024), maxArchiveLineSize)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("archive is empty")
+	}
+
+	var header archiveHeader
+	err = json.Unmarshal(sc.Bytes(), &header)
+	if err != nil {
+		return 0, fmt.Errorf("error reading archive header: %w", err)
+	}
+	if header.Format != archiveFormat {
+		return 0, fmt.Errorf("unknown archive format '%s'", header.Format)
+	}
+	if header.Version > archiveVersion {
+		return 0, fmt.Errorf("unsupported archive version %d", header.Version)
+	}
+
+	count := 0
+	for sc.Scan() {
+		var rec archiveRecord
+		err = json.Unmarshal(sc.Bytes(), &rec)
+		if err != nil {
+			return count, fmt.Errorf("error reading track #%d: %w", count+1, err)
+		}
+
+		err = dst.ImportTrack(ctx, rec.ID, &Track{CreatedAt: rec.CreatedAt, Points: rec.Points})
+		if err != nil {
+			return count, fmt.Errorf("error importing track %s: %w", rec.ID, err)
+		}
+		count++
+	}
+
+	return count, sc.Err()
+}
@@ -0,0 +1,202 @@
+package track
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+// CompressAction tells a track engine what to do with a new point
+type CompressAction int
+
+const (
+	// ActionAppend means the point must be appended to the track
+	ActionAppend CompressAction = iota
+	// ActionReplaceLast means the last stored point is redundant and
+	// must be replaced by the new one
+	ActionReplaceLast
+	// ActionSkip means the new point must not be stored at all
+	ActionSkip
+)
+
+const (
+	// max altitude deviation from a straight climb/descent for a point
+	// to be considered lying on a straight line
+	compressAltToleranceFt = 100
+	// max number of points a single straight segment may replace,
+	// the segment is closed once it's reached
+	maxSegmentDropped = 64
+	// segments of tracks not written to for that long are forgotten
+	segmentTTL = int64(time.Hour / time.Second)
+)
+
+// MaxCompressedGap is the longest time between two stored points of
+// a moving aircraft sampled every period, longer gaps aren't produced
+// by compression. Stationary runs are not limited.
+func MaxCompressedGap(period time.Duration) time.Duration {
+	return time.Duration(maxSegmentDropped+1) * period
+}
+
+// segment is a straight part of a track being extended, the points
+// it replaced are kept to be checked against every new end of it
+type segment struct {
+	// timestamps of the stored points the segment starts and ends at
+	anchor  int64
+	end     int64
+	dropped []TrackPoint
+}
+
+// Compressor applies the compression rule shared by all the track
+// engines and keeps points dropped from the straight segments being
+// extended. Engines keep only the stored points so that's the only
+// place they can be checked at.
+type Compressor struct {
+	tolerance float64
+	segments  map[string]*segment
+	newest    int64
+	pruned    int64
+	lock      sync.Mutex
+}
+
+func NewCompressor(toleranceNM float64) *Compressor {
+	return &Compressor{
+		tolerance: toleranceNM,
+		segments:  make(map[string]*segment),
+	}
+}
+
+// Compress tells what to do with a new point of a track. tail is
+// the end of the stored track in chronological order, only the last
+// two points are taken into account.
+//
+// Points older than the last one and exact duplicates are skipped,
+// a point having the same timestamp as the last one replaces it.
+// A stationary aircraft keeps only the first and the latest sample of
+// a run of identical points. If the tolerance is positive, the last
+// point is also replaced when it and every point it has replaced so
+// far lie on a straight line between the point before it and the new
+// one, within the tolerance laterally and compressAltToleranceFt
+// vertically.
+func (c *Compressor) Compress(trackID string, tail []TrackPoint, point TrackPoint) CompressAction {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.prune(point.TimeStamp)
+
+	if len(tail) == 0 {
+		delete(c.segments, trackID)
+		return ActionAppend
+	}
+
+	last := tail[len(tail)-1]
+	if point.TimeStamp < last.TimeStamp {
+		// This is an older point, that happens sometimes because of inconsistent caching
+		// on vatsim side.
+		return ActionSkip
+	}
+
+	// the segment may be outdated if the track has been
+	// written by somebody else, i.e. imported
+	seg := c.segments[trackID]
+	if seg != nil && (len(tail) < 2 || seg.anchor != tail[len(tail)-2].TimeStamp || seg.end != last.TimeStamp) {
+		seg = nil
+	}
+	delete(c.segments, trackID)
+
+	if point.TimeStamp == last.TimeStamp {
+		// there may be only one point per second, the latest data wins
+		if !point.NE(last) {
+			c.keep(trackID, seg)
+			return ActionSkip
+		}
+		return ActionReplaceLast
+	}
+
+	if len(tail) < 2 {
+		// not enough room for compression
+		return ActionAppend
+	}
+
+	prev := tail[len(tail)-2]
+	if !prev.NE(last) && !last.NE(point) {
+		// the aircraft is standing still
+		return ActionReplaceLast
+	}
+
+	if c.tolerance <= 0 {
+		return ActionAppend
+	}
+
+	if seg == nil {
+		seg = &segment{anchor: prev.TimeStamp}
+	}
+	if len(seg.dropped) >= maxSegmentDropped || !onStraightLine(prev, last, point, c.tolerance) {
+		return ActionAppend
+	}
+	for _, dropped := range seg.dropped {
+		if !onStraightLine(prev, dropped, point, c.tolerance) {
+			return ActionAppend
+		}
+	}
+
+	seg.dropped = append(seg.dropped, last)
+	seg.end = point.TimeStamp
+	c.keep(trackID, seg)
+	return ActionReplaceLast
+}
+
+func (c *Compressor) keep(trackID string, seg *segment) {
+	if seg != nil {
+		c.segments[trackID] = seg
+	}
+}
+
+// prune forgets segments of tracks which are no longer written
+func (c *Compressor) prune(ts int64) {
+	if ts > c.newest {
+		c.newest = ts
+	}
+	if c.newest-c.pruned < segmentTTL {
+		return
+	}
+	for trackID, seg := range c.segments {
+		if c.newest-seg.end > segmentTTL {
+			delete(c.segments, trackID)
+		}
+	}
+	c.pruned = c.newest
+}
+
+// onStraightLine checks if mid lies on the great circle segment
+// between start and end, and was passed at a constant rate
+func onStraightLine(start, mid, end TrackPoint, toleranceNM float64) bool {
+	if end.TimeStamp <= start.TimeStamp {
+		return false
+	}
+
+	// vertical check first as it's way cheaper
+	k := float64(mid.TimeStamp-start.TimeStamp) / float64(end.TimeStamp-start.TimeStamp)
+	expectedAlt := float64(start.Altitude) + k*float64(end.Altitude-start.Altitude)
+	if math.Abs(float64(mid.Altitude)-expectedAlt) > compressAltToleranceFt {
+		return false
+	}
+
+	distMid := geo.DistanceNM(start.Latitude, start.Longitude, mid.Latitude, mid.Longitude)
+	distEnd := geo.DistanceNM(start.Latitude, start.Longitude, end.Latitude, end.Longitude)
+	if distEnd < toleranceNM {
+		// the segment is too short to have a meaningful direction
+		return distMid <= toleranceNM
+	}
+
+	course := geo.Bearing(start.Latitude, start.Longitude, end.Latitude, end.Longitude)
+	dxt := geo.CrossTrackNM(start.Latitude, start.Longitude, course, mid.Latitude, mid.Longitude)
+	if math.Abs(dxt) > toleranceNM {
+		return false
+	}
+
+	// the point must also be where the aircraft would be flying at
+	// a constant speed along the segment
+	dat := geo.AlongTrackNM(start.Latitude, start.Longitude, course, mid.Latitude, mid.Longitude)
+	return math.Abs(dat-k*distEnd) <= toleranceNM
+}
@@ -0,0 +1,128 @@
+package track
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vatsimnerd/simwatch/geo"
+)
+
+// store applies compression the way engines do
+func store(c *Compressor, points []TrackPoint) []TrackPoint {
+	stored := make([]TrackPoint, 0)
+	for _, point := range points {
+		switch c.Compress("AAA1", stored, point) {
+		case ActionAppend:
+			stored = append(stored, point)
+		case ActionReplaceLast:
+			stored[len(stored)-1] = point
+		}
+	}
+	return stored
+}
+
+// flight generates a level flight at 450kt sampled every 15s turning
+// turnRate degrees off the great circle between samples
+func flight(count int, turnRate float64) []TrackPoint {
+	points := make([]TrackPoint, count)
+	lat, lng, course := 50.0, 10.0, 90.0
+	for i := range points {
+		points[i] = TrackPoint{Latitude: lat, Longitude: lng, Altitude: 35000, Groundspeed: 450, TimeStamp: int64(1600000000 + i*15)}
+		nlat, nlng := geo.Destination(lat, lng, course, 450.0/3600*15)
+		// the course the great circle arrives with
+		course = geo.NormalizeBearing(geo.Bearing(nlat, nlng, lat, lng) + 180 + turnRate)
+		lat, lng = nlat, nlng
+	}
+	return points
+}
+
+func TestCompressStraightLine(t *testing.T) {
+	points := flight(20, 0)
+	stored := store(NewCompressor(0.5), points)
+	if len(stored) != 2 {
+		t.Fatalf("expected a straight flight to be stored as 2 points, got %d", len(stored))
+	}
+	if stored[1] != points[len(points)-1] {
+		t.Fatalf("the latest point must be kept, got %v", stored[1])
+	}
+
+	// compression is disabled
+	stored = store(NewCompressor(0), points)
+	if len(stored) != len(points) {
+		t.Fatalf("expected all %d points stored, got %d", len(points), len(stored))
+	}
+}
+
+func TestCompressGradualTurn(t *testing.T) {
+	const tolerance = 0.5
+	points := flight(60, 1)
+	stored := store(NewCompressor(tolerance), points)
+	if len(stored) < 3 || len(stored) == len(points) {
+		t.Fatalf("unexpected number of stored points %d", len(stored))
+	}
+
+	// every sample must be within tolerance of the stored segment
+	// it was replaced by
+	seg := 0
+	for _, pt := range points {
+		for seg < len(stored)-2 && pt.TimeStamp > stored[seg+1].TimeStamp {
+			seg++
+		}
+		start, end := stored[seg], stored[seg+1]
+		course := geo.Bearing(start.Latitude, start.Longitude, end.Latitude, end.Longitude)
+		dxt := geo.CrossTrackNM(start.Latitude, start.Longitude, course, pt.Latitude, pt.Longitude)
+		if math.Abs(dxt) > tolerance {
+			t.Fatalf("point at %d is %.2fnm off the stored track", pt.TimeStamp, dxt)
+		}
+	}
+}
+
+func TestCompressSegmentLimit(t *testing.T) {
+	stored := store(NewCompressor(0.5), flight(maxSegmentDropped*3, 0))
+	if len(stored) != 4 {
+		t.Fatalf("expected the straight line to be split into 3 segments, got %d points", len(stored))
+	}
+}
+
+func TestCompressOutdatedSegment(t *testing.T) {
+	c := NewCompressor(0.5)
+	points := flight(10, 0)
+	store(c, points[:5])
+
+	// the track has been rewritten, i.e. imported, the points the
+	// segment replaced are unrelated to it
+	imported := []TrackPoint{points[0], points[1]}
+	if action := c.Compress("AAA1", imported, points[2]); action != ActionReplaceLast {
+		t.Fatalf("expected the imported tail to be compressed, got %v", action)
+	}
+}
+
+func TestCompressSkip(t *testing.T) {
+	c := NewCompressor(0.5)
+	points := flight(3, 0)
+	stored := store(c, points[:2])
+
+	if action := c.Compress("AAA1", stored, points[0]); action != ActionSkip {
+		t.Fatalf("expected an older point to be skipped, got %v", action)
+	}
+	if action := c.Compress("AAA1", stored, points[1]); action != ActionSkip {
+		t.Fatalf("expected a duplicate to be skipped, got %v", action)
+	}
+
+	moved := points[1]
+	moved.Altitude += 1000
+	if action := c.Compress("AAA1", stored, moved); action != ActionReplaceLast {
+		t.Fatalf("expected a point with the same timestamp to replace the last one, got %v", action)
+	}
+}
+
+func TestCompressStationary(t *testing.T) {
+	points := make([]TrackPoint, 10)
+	for i := range points {
+		points[i] = TrackPoint{Latitude: 50, Longitude: 10, TimeStamp: int64(1600000000 + i*15)}
+	}
+	stored := store(NewCompressor(0), points)
+	if len(stored) != 2 || stored[1].TimeStamp != points[len(points)-1].TimeStamp {
+		t.Fatalf("expected the first and the latest samples, got %v", stored)
+	}
+}
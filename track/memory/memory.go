@@ -14,16 +14,20 @@ import (
 type MemoryReadWriter struct {
 	tracks      map[string]*track.Track
 	purgePeriod time.Duration
+	compressor  *track.Compressor
 	configured  bool
 	stop        chan struct{}
 	lock        sync.Mutex
 }
 
 var (
-	ReadWriter = &MemoryReadWriter{tracks: make(map[string]*track.Track), stop: make(chan struct{})}
-	log        = logrus.WithField("module", "track.memory")
+	log = logrus.WithField("module", "track.memory")
 )
 
+func New() *MemoryReadWriter {
+	return &MemoryReadWriter{tracks: make(map[string]*track.Track), stop: make(chan struct{})}
+}
+
 func (m *MemoryReadWriter) LoadTrackByID(ctx context.Context, id string) (*track.Track, error) {
 	if !m.configured {
 		return nil, track.ErrNotConfigured
@@ -33,11 +37,36 @@ func (m *MemoryReadWriter) LoadTrackByID(ctx context.Context, id string) (*track
 	defer m.lock.Unlock()
 
 	if t, found := m.tracks[id]; found {
-		return t, nil
+		return copyTrack(t, t.Points), nil
+	}
+	return nil, track.ErrNotFound
+}
+
+func (m *MemoryReadWriter) LoadTrackWindow(ctx context.Context, id string, from int64, to int64) (*track.Track, error) {
+	if !m.configured {
+		return nil, track.ErrNotConfigured
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if t, found := m.tracks[id]; found {
+		return copyTrack(t, track.WindowPoints(t.Points, from, to)), nil
 	}
 	return nil, track.ErrNotFound
 }
 
+// copyTrack detaches points from the stored track
+// as the last point may be replaced in place
+func copyTrack(t *track.Track, points []track.TrackPoint) *track.Track {
+	cp := &track.Track{
+		CreatedAt: t.CreatedAt,
+		Points:    make([]track.TrackPoint, len(points)),
+	}
+	copy(cp.Points, points)
+	return cp
+}
+
 func (m *MemoryReadWriter) WriteTrack(ctx context.Context, p *merged.Pilot) error {
 	l := log.WithFields(logrus.Fields{
 		"func":     "WriteTrack",
@@ -53,7 +82,26 @@ func (m *MemoryReadWriter) WriteTrack(ctx context.Context, p *merged.Pilot) erro
 
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	m.writePointUnsafe(trackID, point)
 
+	return nil
+}
+
+func (m *MemoryReadWriter) WriteBatch(ctx context.Context, records []track.PointRecord) error {
+	if !m.configured {
+		return track.ErrNotConfigured
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, rec := range records {
+		m.writePointUnsafe(rec.TrackID, rec.Point)
+	}
+
+	return nil
+}
+
+func (m *MemoryReadWriter) writePointUnsafe(trackID string, point track.TrackPoint) {
 	t, found := m.tracks[trackID]
 	if !found {
 		t = &track.Track{
@@ -63,20 +111,36 @@ func (m *MemoryReadWriter) WriteTrack(ctx context.Context, p *merged.Pilot) erro
 		m.tracks[trackID] = t
 	}
 
-	if len(t.Points) < 2 || (t.Points[len(t.Points)-1].NE(point)) {
-		// the new point is different or there's not enough
-		// room for compression
+	point = track.WithVerticalRate(t.Points, point)
+	switch m.compressor.Compress(trackID, t.Points, point) {
+	case track.ActionAppend:
 		t.Points = append(t.Points, point)
-	} else {
-		// the new point is identical to previous one, updating
-		// timestamp for compression purposes
-		t.Points[len(t.Points)-1].TimeStamp = point.TimeStamp
+	case track.ActionReplaceLast:
+		t.Points[len(t.Points)-1] = point
 	}
+}
 
+func (m *MemoryReadWriter) ImportTrack(ctx context.Context, id string, t *track.Track) error {
+	if !m.configured {
+		return track.ErrNotConfigured
+	}
+
+	points := make([]track.TrackPoint, len(t.Points))
+	copy(points, t.Points)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.tracks[id] = &track.Track{
+		CreatedAt: t.CreatedAt,
+		Points:    points,
+	}
 	return nil
 }
 
 func (m *MemoryReadWriter) ListIDs(ctx context.Context) ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	ids := make([]string, len(m.tracks))
 	i := 0
 	for key := range m.tracks {
@@ -89,6 +153,7 @@ func (m *MemoryReadWriter) ListIDs(ctx context.Context) ([]string, error) {
 func (m *MemoryReadWriter) Configure(cfg *config.TrackConfigOptions) error {
 	m.configured = true
 	m.purgePeriod = cfg.PurgePeriod
+	m.compressor = track.NewCompressor(cfg.CompressTolerance)
 	go m.gc()
 	return nil
 }
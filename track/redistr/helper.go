@@ -3,6 +3,8 @@ package redistr
 import (
 	"context"
 	"strconv"
+
+	"github.com/vatsimnerd/simwatch/track"
 )
 
 const (
@@ -27,24 +29,70 @@ func trackCreatedKey(trackID string) string {
 	return keyPrefixTrack + keySeparator + trackID + keySeparator + "created_at"
 }
 
-func (r *RedisReadWriter) getHInt(ctx context.Context, key string, field string) (int, error) {
-	sv, err := r.cli.HGet(ctx, key, field).Result()
+// pointValue makes a point hash out of a track point
+func pointValue(point track.TrackPoint) map[string]interface{} {
+	return map[string]interface{}{
+		"alt": point.Altitude,
+		"gs":  point.Groundspeed,
+		"hdg": point.Heading,
+		"lat": point.Latitude,
+		"lng": point.Longitude,
+		"vs":  point.VerticalRate,
+		"sqk": point.Squawk,
+		"qnh": point.QNH,
+		"gnd": point.OnGround,
+	}
+}
+
+// parsePoint makes a track point out of a point hash
+func parsePoint(ts string, values map[string]string) (*track.TrackPoint, error) {
+	if len(values) == 0 {
+		return nil, errPointNotFound
+	}
+
+	alt, err := strconv.ParseInt(values["alt"], 10, 64)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	iv, err := strconv.ParseInt(sv, 10, 64)
+	gs, err := strconv.ParseInt(values["gs"], 10, 64)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return int(iv), nil
-}
-
-func (r *RedisReadWriter) getHFloat(ctx context.Context, key string, field string) (float64, error) {
-	sv, err := r.cli.HGet(ctx, key, field).Result()
+	hdg, err := strconv.ParseInt(values["hdg"], 10, 64)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	lat, err := strconv.ParseFloat(values["lat"], 64)
+	if err != nil {
+		return nil, err
+	}
+	lng, err := strconv.ParseFloat(values["lng"], 64)
+	if err != nil {
+		return nil, err
 	}
-	return strconv.ParseFloat(sv, 64)
+	its, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// fields below are optional as points written by
+	// older versions don't have them
+	vs, _ := strconv.ParseInt(values["vs"], 10, 64)
+	qnh, _ := strconv.ParseInt(values["qnh"], 10, 64)
+	gnd, _ := strconv.ParseBool(values["gnd"])
+
+	return &track.TrackPoint{
+		Altitude:     int(alt),
+		Groundspeed:  int(gs),
+		Heading:      int(hdg),
+		Latitude:     lat,
+		Longitude:    lng,
+		TimeStamp:    its,
+		VerticalRate: int(vs),
+		Squawk:       values["sqk"],
+		QNH:          int(qnh),
+		OnGround:     gnd,
+	}, nil
 }
 
 func (r *RedisReadWriter) getInt64(ctx context.Context, key string) (int64, error) {
@@ -17,17 +17,21 @@ import (
 type RedisReadWriter struct {
 	cfg        *config.TrackConfigOptions
 	cli        *redis.Client
+	compressor *track.Compressor
 	stop       chan struct{}
 	configured bool
 }
 
 var (
-	ReadWriter = &RedisReadWriter{stop: make(chan struct{})}
-	log        = logrus.WithField("module", "track.redistr")
+	log = logrus.WithField("module", "track.redistr")
 
 	errPointNotFound = errors.New("point not found")
 )
 
+func New() *RedisReadWriter {
+	return &RedisReadWriter{stop: make(chan struct{})}
+}
+
 func (r *RedisReadWriter) setupClient() {
 	r.cli = redis.NewClient(&redis.Options{
 		Addr:     r.cfg.Addr,
@@ -37,6 +41,25 @@ func (r *RedisReadWriter) setupClient() {
 }
 
 func (r *RedisReadWriter) LoadTrackByID(ctx context.Context, trackID string) (*track.Track, error) {
+	return r.loadTrack(ctx, trackID, func(tss []string) []string { return tss })
+}
+
+func (r *RedisReadWriter) LoadTrackWindow(ctx context.Context, trackID string, from int64, to int64) (*track.Track, error) {
+	return r.loadTrack(ctx, trackID, func(tss []string) []string {
+		// the index holds timestamps in order, points themselves
+		// are fetched only for the window
+		stamps := make([]int64, len(tss))
+		for i, ts := range tss {
+			stamps[i], _ = strconv.ParseInt(ts, 10, 64)
+		}
+		start, end := track.WindowRange(len(stamps), func(i int) int64 { return stamps[i] }, from, to)
+		return tss[start:end]
+	})
+}
+
+// loadTrack fetches points picked by the timestamp selector
+// using a single pipelined round trip
+func (r *RedisReadWriter) loadTrack(ctx context.Context, trackID string, selectTS func([]string) []string) (*track.Track, error) {
 	if !r.trackExists(ctx, trackID) {
 		return nil, track.ErrNotFound
 	}
@@ -51,15 +74,28 @@ func (r *RedisReadWriter) LoadTrackByID(ctx context.Context, trackID string) (*t
 	if err != nil {
 		return nil, err
 	}
+	tridcs = selectTS(tridcs)
+
+	cmds := make([]*redis.StringStringMapCmd, len(tridcs))
+	_, err = r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, pix := range tridcs {
+			cmds[i] = pipe.HGetAll(ctx, pointKey(trackID, pix))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
 
 	tr := &track.Track{
 		CreatedAt: time.Unix(createdUx, 0),
 		Points:    make([]track.TrackPoint, 0, len(tridcs)),
 	}
 
-	for _, pix := range tridcs {
-		p, err := r.getPoint(ctx, trackID, pix)
+	for i, pix := range tridcs {
+		p, err := parsePoint(pix, cmds[i].Val())
 		if err != nil {
+			// removed by gc meanwhile
 			continue
 		}
 		tr.Points = append(tr.Points, *p)
@@ -69,194 +105,195 @@ func (r *RedisReadWriter) LoadTrackByID(ctx context.Context, trackID string) (*t
 }
 
 func (r *RedisReadWriter) WriteTrack(ctx context.Context, p *merged.Pilot) error {
-	l := log.WithFields(logrus.Fields{
-		"func":     "WriteTrack",
-		"callsign": p.Callsign,
-	})
-
-	if !r.configured {
-		return track.ErrNotConfigured
-	}
-
 	trackID, point := track.ExtractTrackData(p)
-	l.WithFields(logrus.Fields{"track_id": trackID, "point": point}).Trace("extracted")
-
-	if !r.trackExists(ctx, trackID) {
-		err := r.createTrack(ctx, trackID)
-		if err != nil {
-			return fmt.Errorf("error creating track: %w", err)
-		}
-	}
-
-	err := r.writeTrackPoint(ctx, trackID, point)
-	if err != nil {
-		return fmt.Errorf("error writing track point: %w", err)
-	}
-
-	return nil
+	return r.WriteBatch(ctx, []track.PointRecord{{TrackID: trackID, Point: point}})
 }
 
-func (r *RedisReadWriter) Configure(cfg *config.TrackConfigOptions) error {
-	r.cfg = cfg
-	r.configured = true
-	r.setupClient()
-	go r.gc()
-	return nil
+// trackState is what WriteBatch needs to know about a stored track
+// to append points to it
+type trackState struct {
+	exists bool
+	// tail holds up to two last points of the track
+	tail []track.TrackPoint
 }
 
-func (r *RedisReadWriter) ListIDs(ctx context.Context) ([]string, error) {
-	res, err := r.cli.SMembers(ctx, keyTrackIDs).Result()
-	if err != nil {
-		return []string{}, err
+func (r *RedisReadWriter) WriteBatch(ctx context.Context, records []track.PointRecord) error {
+	l := log.WithFields(logrus.Fields{
+		"func":  "WriteBatch",
+		"count": len(records),
+	})
+
+	if !r.configured {
+		return track.ErrNotConfigured
 	}
-	return res, nil
-}
 
-func (r *RedisReadWriter) trackExists(ctx context.Context, trackID string) bool {
-	val, err := r.cli.SIsMember(ctx, keyTrackIDs, trackID).Result()
+	states, err := r.loadTrackStates(ctx, records)
 	if err != nil {
-		return false
+		return fmt.Errorf("error loading tracks state: %w", err)
 	}
-	return val
-}
 
-func (r *RedisReadWriter) createTrack(ctx context.Context, trackID string) error {
-	err := r.cli.SAdd(ctx, keyTrackIDs, trackID).Err()
+	_, err = r.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, rec := range records {
+			st := states[rec.TrackID]
+			r.appendPoint(ctx, pipe, rec.TrackID, rec.Point, st)
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		l.WithError(err).Error("error writing track points")
+		return fmt.Errorf("error writing track points: %w", err)
 	}
-
-	key := trackCreatedKey(trackID)
-	return r.cli.Set(ctx, key, time.Now().Unix(), 0).Err()
+	return nil
 }
 
-func (r *RedisReadWriter) getPoint(ctx context.Context, trackID string, ts string) (*track.TrackPoint, error) {
-	key := pointKey(trackID, ts)
+// loadTrackStates fetches existence and the tail of every track
+// mentioned in records using two pipelined round trips
+func (r *RedisReadWriter) loadTrackStates(ctx context.Context, records []track.PointRecord) (map[string]*trackState, error) {
+	states := make(map[string]*trackState)
+	existsCmds := make(map[string]*redis.BoolCmd)
+	tailCmds := make(map[string]*redis.StringSliceCmd)
 
-	ex, err := r.cli.Exists(ctx, key).Result()
-	if err != nil {
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, rec := range records {
+			if _, found := existsCmds[rec.TrackID]; found {
+				continue
+			}
+			existsCmds[rec.TrackID] = pipe.SIsMember(ctx, keyTrackIDs, rec.TrackID)
+			tailCmds[rec.TrackID] = pipe.LRange(ctx, pointsIndexKey(rec.TrackID), -2, -1)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
-	if ex == 0 {
-		return nil, errPointNotFound
-	}
 
-	alt, err := r.getHInt(ctx, key, "alt")
-	if err != nil {
-		return nil, err
-	}
-	gs, err := r.getHInt(ctx, key, "gs")
-	if err != nil {
-		return nil, err
-	}
-	hdg, err := r.getHInt(ctx, key, "hdg")
-	if err != nil {
-		return nil, err
-	}
-	lat, err := r.getHFloat(ctx, key, "lat")
-	if err != nil {
-		return nil, err
-	}
-	lng, err := r.getHFloat(ctx, key, "lng")
-	if err != nil {
+	pointCmds := make(map[string][]*redis.StringStringMapCmd)
+	tailTS := make(map[string][]string)
+	_, err = r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for trackID := range existsCmds {
+			states[trackID] = &trackState{
+				exists: existsCmds[trackID].Val(),
+				tail:   make([]track.TrackPoint, 0, 2),
+			}
+			tailTS[trackID] = tailCmds[trackID].Val()
+			for _, ts := range tailTS[trackID] {
+				pointCmds[trackID] = append(pointCmds[trackID], pipe.HGetAll(ctx, pointKey(trackID, ts)))
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
-	its, err := strconv.ParseInt(ts, 10, 64)
-	if err != nil {
-		return nil, err
+
+	for trackID, cmds := range pointCmds {
+		st := states[trackID]
+		for i, cmd := range cmds {
+			pt, err := parsePoint(tailTS[trackID][i], cmd.Val())
+			if err != nil {
+				// the point may have been removed by gc, the track
+				// just won't be compressed this time
+				continue
+			}
+			st.tail = append(st.tail, *pt)
+		}
 	}
-	return &track.TrackPoint{
-		Altitude:    alt,
-		Groundspeed: gs,
-		Heading:     hdg,
-		Latitude:    lat,
-		Longitude:   lng,
-		TimeStamp:   its,
-	}, nil
 
+	return states, nil
 }
 
-func (r *RedisReadWriter) writeTrackPoint(ctx context.Context, trackID string, point track.TrackPoint) error {
+// appendPoint queues commands adding the point to the track and updates
+// the track state accordingly
+func (r *RedisReadWriter) appendPoint(ctx context.Context, pipe redis.Pipeliner, trackID string, point track.TrackPoint, st *trackState) {
 	l := log.WithFields(logrus.Fields{
-		"func": "writeTrackPoint",
+		"func": "appendPoint",
 		"tid":  trackID,
 		"pt":   point,
 	})
 
 	trackIdxKey := pointsIndexKey(trackID)
-	trackSize, _ := r.cli.LLen(ctx, trackIdxKey).Result()
 
-	if trackSize > 0 {
-		// check if the new point is older than the last one
-		last, err := r.cli.LIndex(ctx, trackIdxKey, trackSize-1).Result()
-		if err != nil {
-			return err
-		}
-		l = l.WithField("last", last)
-		ilast, err := strconv.ParseInt(last, 10, 64)
-		if err != nil {
-			// this should never happen but just in case someone messed up data in redis
-			return err
-		}
+	if !st.exists {
+		pipe.SAdd(ctx, keyTrackIDs, trackID)
+		pipe.Set(ctx, trackCreatedKey(trackID), time.Now().Unix(), 0)
+		st.exists = true
+	}
 
-		if ilast > point.TimeStamp {
-			l.Trace("new point is older")
-			// This is an older point, that happens sometimes because of inconsistent caching
-			// on vatsim side. For now we just skip this point
-			return nil
-		}
+	point = track.WithVerticalRate(st.tail, point)
+	switch r.compressor.Compress(trackID, st.tail, point) {
+	case track.ActionSkip:
+		l.Trace("point skipped")
+		return
+	case track.ActionReplaceLast:
+		l.Trace("point compressed, removing old")
+		last := st.tail[len(st.tail)-1]
+		pipe.Del(ctx, pointKey(trackID, strconv.FormatInt(last.TimeStamp, 10)))
+		pipe.RPop(ctx, trackIdxKey)
+		st.tail = st.tail[:len(st.tail)-1]
+	}
 
-		if trackSize > 1 {
-			// We may want to compress this point if the aircraft is standing at the
-			// gate
+	ts := strconv.FormatInt(point.TimeStamp, 10)
 
-			lastPoint, err := r.getPoint(ctx, trackID, last)
-			if err != nil {
-				l.WithError(err).Error("error getting point")
-				return err
-			}
+	// push point itself
+	pipe.HSet(ctx, pointKey(trackID, ts), pointValue(point))
+	// push point index
+	pipe.RPush(ctx, trackIdxKey, ts)
 
-			if !point.NE(*lastPoint) {
-				l.Trace("points match, removing old")
-				// eligible for compression, remove last point
-				err = r.cli.Del(ctx, pointKey(trackID, last)).Err()
-				if err != nil {
-					l.WithError(err).Error("error removing point")
-				}
-				err = r.cli.RPop(ctx, trackIdxKey).Err()
-				if err != nil {
-					l.WithError(err).Error("error removing point index")
-				}
-			} else {
-				l.Trace("points don't match")
-			}
-		} else {
-			l.Trace("track can't be compressed")
-		}
-	} else {
-		l.Trace("track is empty")
+	st.tail = append(st.tail, point)
+	if len(st.tail) > 2 {
+		st.tail = st.tail[len(st.tail)-2:]
 	}
+}
 
-	ts := strconv.FormatInt(point.TimeStamp, 10)
+func (r *RedisReadWriter) ImportTrack(ctx context.Context, trackID string, t *track.Track) error {
+	if !r.configured {
+		return track.ErrNotConfigured
+	}
 
-	// push point itself
-	pk := pointKey(trackID, ts)
-	value := map[string]interface{}{
-		"alt": point.Altitude,
-		"gs":  point.Groundspeed,
-		"hdg": point.Heading,
-		"lat": point.Latitude,
-		"lng": point.Longitude,
+	if r.trackExists(ctx, trackID) {
+		err := r.deleteTrack(ctx, trackID)
+		if err != nil {
+			return fmt.Errorf("error removing existing track: %w", err)
+		}
 	}
-	l.Trace("pushing point")
-	err := r.cli.HSet(ctx, pk, value).Err()
+
+	trackIdxKey := pointsIndexKey(trackID)
+	_, err := r.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, keyTrackIDs, trackID)
+		pipe.Set(ctx, trackCreatedKey(trackID), t.CreatedAt.Unix(), 0)
+		for _, point := range t.Points {
+			ts := strconv.FormatInt(point.TimeStamp, 10)
+			pipe.HSet(ctx, pointKey(trackID, ts), pointValue(point))
+			pipe.RPush(ctx, trackIdxKey, ts)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisReadWriter) Configure(cfg *config.TrackConfigOptions) error {
+	r.cfg = cfg
+	r.compressor = track.NewCompressor(cfg.CompressTolerance)
+	r.configured = true
+	r.setupClient()
+	go r.gc()
+	return nil
+}
+
+func (r *RedisReadWriter) ListIDs(ctx context.Context) ([]string, error) {
+	res, err := r.cli.SMembers(ctx, keyTrackIDs).Result()
 	if err != nil {
-		return err
+		return []string{}, err
 	}
+	return res, nil
+}
 
-	// push point index
-	l.Trace("pushing point index")
-	return r.cli.RPush(ctx, trackIdxKey, ts).Err()
+func (r *RedisReadWriter) trackExists(ctx context.Context, trackID string) bool {
+	val, err := r.cli.SIsMember(ctx, keyTrackIDs, trackID).Result()
+	if err != nil {
+		return false
+	}
+	return val
 }
 
 func (r *RedisReadWriter) deleteTrack(ctx context.Context, trackID string) error {
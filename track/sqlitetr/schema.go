@@ -0,0 +1,123 @@
+package sqlitetr
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/track"
+)
+
+//go:embed schema.sql
+var schema string
+
+// pointColumnMigrations lists track_points columns added after the
+// initial schema. Databases created by older versions get them added
+// on startup.
+var pointColumnMigrations = []struct {
+	name       string
+	definition string
+}{
+	{"vertical_rate", "INTEGER DEFAULT 0"},
+	{"squawk", "VARCHAR DEFAULT ''"},
+	{"qnh", "INTEGER DEFAULT 0"},
+	{"on_ground", "BOOLEAN DEFAULT 0"},
+}
+
+const (
+	pointColumns   = "latitude, longitude, altitude, heading, groundspeed, vertical_rate, squawk, qnh, on_ground, ts"
+	insertPointSQL = "INSERT INTO track_points (track_id, " + pointColumns + ") VALUES (?,?,?,?,?,?,?,?,?,?,?)"
+)
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *SQLiteReadWriter) migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, schema)
+	if err != nil {
+		return fmt.Errorf("error applying schema: %w", err)
+	}
+
+	cur, err := r.db.QueryContext(ctx, "PRAGMA table_info(track_points)")
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for cur.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		err = cur.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk)
+		if err != nil {
+			cur.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	cur.Close()
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range pointColumnMigrations {
+		if existing[col.name] {
+			continue
+		}
+		log.WithField("column", col.name).Info("migrating track_points table")
+		_, err = r.db.ExecContext(ctx,
+			fmt.Sprintf("ALTER TABLE track_points ADD COLUMN %s %s", col.name, col.definition))
+		if err != nil {
+			return fmt.Errorf("error adding column %s: %w", col.name, err)
+		}
+	}
+	return nil
+}
+
+// scanPoint reads a point selected as pointColumns
+func scanPoint(sc scanner, extra ...interface{}) (track.TrackPoint, error) {
+	var lat, lng float64
+	var alt, hdg, gs, vs, qnh int64
+	var sqk string
+	var gnd bool
+	var ts time.Time
+
+	dest := append(extra, &lat, &lng, &alt, &hdg, &gs, &vs, &sqk, &qnh, &gnd, &ts)
+	err := sc.Scan(dest...)
+	if err != nil {
+		return track.TrackPoint{}, err
+	}
+
+	return track.TrackPoint{
+		Latitude:     lat,
+		Longitude:    lng,
+		Altitude:     int(alt),
+		Heading:      int(hdg),
+		Groundspeed:  int(gs),
+		VerticalRate: int(vs),
+		Squawk:       sqk,
+		QNH:          int(qnh),
+		OnGround:     gnd,
+		TimeStamp:    ts.Unix(),
+	}, nil
+}
+
+// pointArgs makes insertPointSQL arguments
+func pointArgs(trackID int64, point track.TrackPoint) []interface{} {
+	return []interface{}{
+		trackID,
+		point.Latitude,
+		point.Longitude,
+		point.Altitude,
+		point.Heading,
+		point.Groundspeed,
+		point.VerticalRate,
+		point.Squawk,
+		point.QNH,
+		point.OnGround,
+		time.Unix(point.TimeStamp, 0).UTC(),
+	}
+}
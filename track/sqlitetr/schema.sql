@@ -14,6 +14,10 @@ CREATE TABLE IF NOT EXISTS track_points (
   altitude INTEGER,
   heading INTEGER,
   groundspeed INTEGER,
+  vertical_rate INTEGER DEFAULT 0,
+  squawk VARCHAR DEFAULT '',
+  qnh INTEGER DEFAULT 0,
+  on_ground BOOLEAN DEFAULT 0,
   ts DATETIME DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY(track_id) REFERENCES tracks(id) ON DELETE CASCADE
 );
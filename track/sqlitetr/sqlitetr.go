@@ -16,17 +16,22 @@ import (
 type SQLiteReadWriter struct {
 	cfg        *config.TrackConfigOptions
 	db         *sql.DB
+	compressor *track.Compressor
 	stop       chan struct{}
 	configured bool
 }
 
 var (
-	ReadWriter = &SQLiteReadWriter{stop: make(chan struct{})}
-	log        = logrus.WithField("module", "track.memory")
+	log = logrus.WithField("module", "track.memory")
 )
 
+func New() *SQLiteReadWriter {
+	return &SQLiteReadWriter{stop: make(chan struct{})}
+}
+
 func (r *SQLiteReadWriter) Configure(cfg *config.TrackConfigOptions) error {
 	r.cfg = cfg
+	r.compressor = track.NewCompressor(cfg.CompressTolerance)
 	err := r.setupClient()
 	if err != nil {
 		return err
@@ -74,10 +79,28 @@ func (r *SQLiteReadWriter) setupClient() error {
 		return err
 	}
 	r.db = db
-	return nil
+	return r.migrate(context.Background())
 }
 
 func (r *SQLiteReadWriter) LoadTrackByID(ctx context.Context, trackCode string) (*track.Track, error) {
+	return r.loadTrack(ctx, trackCode,
+		"SELECT "+pointColumns+" FROM track_points WHERE track_id = ? ORDER BY ts")
+}
+
+func (r *SQLiteReadWriter) LoadTrackWindow(ctx context.Context, trackCode string, from int64, to int64) (*track.Track, error) {
+	fromTS := time.Unix(from, 0).UTC()
+	toTS := time.Unix(to, 0).UTC()
+	// the window starts with the last point before from if any
+	return r.loadTrack(ctx, trackCode,
+		"SELECT "+pointColumns+" FROM track_points WHERE track_id = ?1"+
+			" AND ts >= COALESCE((SELECT MAX(ts) FROM track_points WHERE track_id = ?1 AND ts < ?2), ?2)"+
+			" AND ts <= ?3 ORDER BY ts",
+		fromTS, toTS)
+}
+
+// loadTrack selects points with a query taking the track row id
+// as the first argument followed by args
+func (r *SQLiteReadWriter) loadTrack(ctx context.Context, trackCode string, query string, args ...interface{}) (*track.Track, error) {
 	var id int64
 	var createdAt time.Time
 	err := r.db.QueryRowContext(ctx,
@@ -88,37 +111,24 @@ func (r *SQLiteReadWriter) LoadTrackByID(ctx context.Context, trackCode string)
 		return nil, err
 	}
 
-	stmt, err := r.db.PrepareContext(ctx, "SELECT latitude, longitude, altitude, heading, groundspeed, ts FROM track_points WHERE track_id = ? ORDER BY ts")
+	stmt, err := r.db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	cur, err := stmt.Query(id)
+	cur, err := stmt.Query(append([]interface{}{id}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 	defer cur.Close()
 
-	var lat, lng float64
-	var alt, hdg, gs int64
-	var ts time.Time
-
 	points := make([]track.TrackPoint, 0)
 	for cur.Next() {
-		err = cur.Scan(&lat, &lng, &alt, &hdg, &gs, &ts)
+		pt, err := scanPoint(cur)
 		if err != nil {
 			return nil, err
 		}
-
-		pt := track.TrackPoint{
-			Latitude:    lat,
-			Longitude:   lng,
-			Altitude:    int(alt),
-			Heading:     int(hdg),
-			Groundspeed: int(gs),
-			TimeStamp:   ts.Unix(),
-		}
 		points = append(points, pt)
 	}
 
@@ -161,56 +171,194 @@ func (r *SQLiteReadWriter) ListIDs(ctx context.Context) ([]string, error) {
 
 func (r *SQLiteReadWriter) WriteTrack(ctx context.Context, p *merged.Pilot) error {
 	trackCode, point := track.ExtractTrackData(p)
-	trackID, err := r.getTrackID(ctx, trackCode)
-	if err != nil {
-		return fmt.Errorf("error checking track: %w", err)
-	}
-	return r.writePoint(ctx, trackID, point)
+	return r.WriteBatch(ctx, []track.PointRecord{{TrackID: trackCode, Point: point}})
 }
 
-func (r *SQLiteReadWriter) Close() error {
-	r.stop <- struct{}{}
-	return r.db.Close()
+// trackTail is the end of a stored track along with the row ids
+// of its points
+type trackTail struct {
+	id     int64
+	points []track.TrackPoint
+	rowIDs []int64
 }
 
-func (r *SQLiteReadWriter) getTrackID(ctx context.Context, trackCode string) (int64, error) {
-	var trackID int64
-	err := r.db.QueryRowContext(ctx, "SELECT id FROM tracks WHERE track_code = ?", trackCode).Scan(&trackID)
+func (r *SQLiteReadWriter) WriteBatch(ctx context.Context, records []track.PointRecord) error {
+	if !r.configured {
+		return track.ErrNotConfigured
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		stmt, err := r.db.PrepareContext(ctx, "INSERT INTO tracks (track_code) VALUES (?)")
-		if err != nil {
-			return 0, err
+		return err
+	}
+	// rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, insertPointSQL)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	remove, err := tx.PrepareContext(ctx, "DELETE FROM track_points WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer remove.Close()
+
+	tails := make(map[string]*trackTail)
+	for _, rec := range records {
+		tail, found := tails[rec.TrackID]
+		if !found {
+			tail, err = r.loadTail(ctx, tx, rec.TrackID)
+			if err != nil {
+				return fmt.Errorf("error checking track: %w", err)
+			}
+			tails[rec.TrackID] = tail
+		}
+
+		point := track.WithVerticalRate(tail.points, rec.Point)
+		switch r.compressor.Compress(rec.TrackID, tail.points, point) {
+		case track.ActionSkip:
+			continue
+		case track.ActionReplaceLast:
+			last := len(tail.points) - 1
+			_, err = remove.ExecContext(ctx, tail.rowIDs[last])
+			if err != nil {
+				return err
+			}
+			tail.points = tail.points[:last]
+			tail.rowIDs = tail.rowIDs[:last]
 		}
-		defer stmt.Close()
 
-		res, err := stmt.Exec(trackCode)
+		res, err := insert.ExecContext(ctx, pointArgs(tail.id, point)...)
 		if err != nil {
-			return 0, err
+			return err
+		}
+		rowID, err := res.LastInsertId()
+		if err != nil {
+			return err
 		}
 
-		trackID, err = res.LastInsertId()
+		tail.points = append(tail.points, point)
+		tail.rowIDs = append(tail.rowIDs, rowID)
+		if len(tail.points) > 2 {
+			tail.points = tail.points[1:]
+			tail.rowIDs = tail.rowIDs[1:]
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadTail finds or creates a track and loads its last two points
+func (r *SQLiteReadWriter) loadTail(ctx context.Context, tx *sql.Tx, trackCode string) (*trackTail, error) {
+	trackID, err := r.getTrackID(ctx, tx, trackCode)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := tx.QueryContext(ctx,
+		"SELECT id, "+pointColumns+" FROM track_points WHERE track_id = ? ORDER BY ts DESC, id DESC LIMIT 2",
+		trackID)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+
+	tail := &trackTail{
+		id:     trackID,
+		points: make([]track.TrackPoint, 0, 2),
+		rowIDs: make([]int64, 0, 2),
+	}
+
+	for cur.Next() {
+		var rowID int64
+		pt, err := scanPoint(cur, &rowID)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
+		// rows come in reverse order
+		tail.points = append([]track.TrackPoint{pt}, tail.points...)
+		tail.rowIDs = append([]int64{rowID}, tail.rowIDs...)
 	}
-	return trackID, nil
+
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+	return tail, nil
 }
 
-func (r *SQLiteReadWriter) writePoint(ctx context.Context, trackID int64, point track.TrackPoint) error {
-	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO track_points (track_id, latitude, longitude, altitude, heading, groundspeed) VALUES (?,?,?,?,?,?)")
+func (r *SQLiteReadWriter) ImportTrack(ctx context.Context, trackCode string, t *track.Track) error {
+	if !r.configured {
+		return track.ErrNotConfigured
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// foreign keys may be disabled for the connection so points
+	// are removed explicitly
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM track_points WHERE track_id IN (SELECT id FROM tracks WHERE track_code = ?)",
+		trackCode)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM tracks WHERE track_code = ?", trackCode)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO tracks (track_code, created_at) VALUES (?, ?)",
+		trackCode, t.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	trackID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, insertPointSQL)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(
-		trackID,
-		point.Latitude,
-		point.Longitude,
-		point.Altitude,
-		point.Heading,
-		point.Groundspeed,
-	)
+	for _, point := range t.Points {
+		_, err = stmt.ExecContext(ctx, pointArgs(trackID, point)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteReadWriter) Close() error {
+	r.stop <- struct{}{}
+	return r.db.Close()
+}
+
+func (r *SQLiteReadWriter) getTrackID(ctx context.Context, tx *sql.Tx, trackCode string) (int64, error) {
+	var trackID int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM tracks WHERE track_code = ?", trackCode).Scan(&trackID)
+	if err != nil {
+		res, err := tx.ExecContext(ctx, "INSERT INTO tracks (track_code) VALUES (?)", trackCode)
+		if err != nil {
+			return 0, err
+		}
 
-	return err
+		trackID, err = res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return trackID, nil
 }
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/vatsimnerd/simwatch-providers/merged"
 	"github.com/vatsimnerd/simwatch/config"
 )
@@ -17,6 +21,16 @@ type TrackPoint struct {
 	Altitude    int     `json:"alt"`
 	Groundspeed int     `json:"gs"`
 	TimeStamp   int64   `json:"ts"`
+
+	// fields below were added later, points stored before
+	// have them zeroed
+
+	// VerticalRate is computed from the previous point, feet per minute
+	VerticalRate int    `json:"vs,omitempty"`
+	Squawk       string `json:"sqk,omitempty"`
+	// QNH is the pilot-set pressure, hPa
+	QNH      int  `json:"qnh,omitempty"`
+	OnGround bool `json:"gnd,omitempty"`
 }
 
 type Track struct {
@@ -24,16 +38,36 @@ type Track struct {
 	Points    []TrackPoint
 }
 
+// PointRecord is a track point bound to its track id, the unit of
+// batched writes
+type PointRecord struct {
+	TrackID string
+	Point   TrackPoint
+}
+
 type TrackReadWriter interface {
 	WriteTrack(context.Context, *merged.Pilot) error
+	WriteBatch(context.Context, []PointRecord) error
 	LoadTrackByID(context.Context, string) (*Track, error)
+	// LoadTrackWindow loads points within [from, to] unix timestamps
+	// along with the last point before from, if any
+	LoadTrackWindow(ctx context.Context, id string, from int64, to int64) (*Track, error)
 	ListIDs(context.Context) ([]string, error)
+	// ImportTrack stores a whole track under the given id replacing
+	// the existing one if any
+	ImportTrack(context.Context, string, *Track) error
 	Configure(cfg *config.TrackConfigOptions) error
 	Close() error
 }
 
+const (
+	onGroundMaxSpeed        = 40
+	maxVerticalRateInterval = 300
+)
+
 var (
 	readWriter       TrackReadWriter = nil
+	log                              = logrus.WithField("module", "track")
 	ErrNotFound                      = errors.New("track not found")
 	ErrNotConfigured                 = errors.New("track writer not configured")
 	ErrConfigInvalid                 = errors.New("invalid configuration type")
@@ -44,7 +78,10 @@ func (tp TrackPoint) NE(op TrackPoint) bool {
 		tp.Longitude != op.Longitude ||
 		tp.Heading != op.Heading ||
 		tp.Altitude != op.Altitude ||
-		tp.Groundspeed != op.Groundspeed
+		tp.Groundspeed != op.Groundspeed ||
+		tp.Squawk != op.Squawk ||
+		tp.QNH != op.QNH ||
+		tp.OnGround != op.OnGround
 }
 
 func RegisterTrackReadWriter(trw TrackReadWriter) {
@@ -55,6 +92,10 @@ func WriteTrack(ctx context.Context, p *merged.Pilot) error {
 	return readWriter.WriteTrack(ctx, p)
 }
 
+func WriteBatch(ctx context.Context, records []PointRecord) error {
+	return readWriter.WriteBatch(ctx, records)
+}
+
 func LoadTrack(ctx context.Context, p *merged.Pilot) (*Track, error) {
 	trackID, _ := ExtractTrackData(p)
 	return LoadTrackByID(ctx, trackID)
@@ -64,6 +105,10 @@ func LoadTrackByID(ctx context.Context, id string) (*Track, error) {
 	return readWriter.LoadTrackByID(ctx, id)
 }
 
+func LoadTrackWindow(ctx context.Context, id string, from int64, to int64) (*Track, error) {
+	return readWriter.LoadTrackWindow(ctx, id, from, to)
+}
+
 func ListIDs(ctx context.Context) ([]string, error) {
 	return readWriter.ListIDs(ctx)
 }
@@ -77,10 +122,95 @@ func ExtractTrackData(p *merged.Pilot) (trackID string, point TrackPoint) {
 		Altitude:    p.Altitude,
 		Groundspeed: p.Groundspeed,
 		TimeStamp:   time.Now().Unix(),
+		Squawk:      p.Transponder,
+		QNH:         p.QnhMb,
+		OnGround:    IsOnGround(p),
 	}
 	return
 }
 
+// ParseTrackID extracts pilot's identity from a track id made
+// by ExtractTrackData
+func ParseTrackID(trackID string) (callsign string, cid int, logonTime time.Time, err error) {
+	idx := strings.LastIndex(trackID, "-")
+	if idx < 0 {
+		err = fmt.Errorf("invalid track id '%s'", trackID)
+		return
+	}
+	logonUx, err := strconv.ParseInt(trackID[idx+1:], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid track id '%s': %w", trackID, err)
+		return
+	}
+
+	rest := trackID[:idx]
+	idx = strings.LastIndex(rest, "-")
+	if idx < 0 {
+		err = fmt.Errorf("invalid track id '%s'", trackID)
+		return
+	}
+	cid, err = strconv.Atoi(rest[idx+1:])
+	if err != nil {
+		err = fmt.Errorf("invalid track id '%s': %w", trackID, err)
+		return
+	}
+
+	callsign = rest[:idx]
+	logonTime = time.Unix(logonUx, 0)
+	return
+}
+
+// WindowPoints returns points within [from, to] along with the last
+// point before from, points must be sorted by timestamps
+func WindowPoints(points []TrackPoint, from int64, to int64) []TrackPoint {
+	start, end := WindowRange(len(points), func(i int) int64 { return points[i].TimeStamp }, from, to)
+	return points[start:end]
+}
+
+// WindowRange is WindowPoints for any sorted sequence of n
+// timestamps, it returns the slice bounds
+func WindowRange(n int, ts func(i int) int64, from int64, to int64) (int, int) {
+	start := sort.Search(n, func(i int) bool {
+		return ts(i) >= from
+	})
+	if start > 0 {
+		start--
+	}
+	end := sort.Search(n, func(i int) bool {
+		return ts(i) > to
+	})
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// IsOnGround guesses if the pilot is on the ground. VATSIM data has
+// no such flag so it's based on groundspeed only which is good enough
+// for taxiing and parked aircraft but not for takeoff and landing rolls.
+func IsOnGround(p *merged.Pilot) bool {
+	return p.Groundspeed < onGroundMaxSpeed
+}
+
+// WithVerticalRate returns the point with vertical rate computed
+// against the last point of tail
+func WithVerticalRate(tail []TrackPoint, point TrackPoint) TrackPoint {
+	point.VerticalRate = 0
+	if len(tail) == 0 {
+		return point
+	}
+
+	last := tail[len(tail)-1]
+	dt := point.TimeStamp - last.TimeStamp
+	if dt <= 0 || dt > maxVerticalRateInterval {
+		// too far apart to make any sense
+		return point
+	}
+
+	point.VerticalRate = int(int64(point.Altitude-last.Altitude) * 60 / dt)
+	return point
+}
+
 func Configure(cfg *config.TrackConfigOptions) error {
 	return readWriter.Configure(cfg)
 }
@@ -0,0 +1,171 @@
+package track
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+)
+
+// Writer sits between the provider and the configured TrackReadWriter.
+// Points are queued without blocking and written in batches, normally
+// once per poll cycle when Flush is called.
+type Writer struct {
+	queue   chan PointRecord
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	timeout time.Duration
+
+	dropped uint64
+	written uint64
+	failed  uint64
+	batches uint64
+}
+
+type WriterStats struct {
+	QueueSize  int    `json:"queue_size"`
+	QueueDepth int    `json:"queue_depth"`
+	Dropped    uint64 `json:"dropped"`
+	Written    uint64 `json:"written"`
+	Failed     uint64 `json:"failed"`
+	Batches    uint64 `json:"batches"`
+}
+
+const (
+	defaultQueueSize    = 32768
+	defaultWriteTimeout = 10 * time.Second
+	// batches are flushed at least this often even if no poll
+	// cycle end has been signalled
+	maxFlushInterval = 30 * time.Second
+)
+
+var (
+	wlog = logrus.WithField("module", "track.writer")
+)
+
+func NewWriter(queueSize int, timeout time.Duration) *Writer {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	if timeout <= 0 {
+		timeout = defaultWriteTimeout
+	}
+	return &Writer{
+		queue:   make(chan PointRecord, queueSize),
+		flush:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		timeout: timeout,
+	}
+}
+
+func (w *Writer) Start() {
+	go w.loop()
+}
+
+// Stop writes whatever is left in the queue and stops the writer loop
+func (w *Writer) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Push extracts the current point from a pilot and queues it.
+// It never blocks, if the queue is full the point is dropped
+// and false is returned.
+func (w *Writer) Push(p *merged.Pilot) bool {
+	trackID, point := ExtractTrackData(p)
+	select {
+	case w.queue <- PointRecord{TrackID: trackID, Point: point}:
+		return true
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+		return false
+	}
+}
+
+// Flush signals the writer loop to write queued points. It doesn't
+// wait for the batch to be written.
+func (w *Writer) Flush() {
+	select {
+	case w.flush <- struct{}{}:
+	default:
+		// a flush is already pending
+	}
+}
+
+func (w *Writer) Stats() WriterStats {
+	return WriterStats{
+		QueueSize:  cap(w.queue),
+		QueueDepth: len(w.queue),
+		Dropped:    atomic.LoadUint64(&w.dropped),
+		Written:    atomic.LoadUint64(&w.written),
+		Failed:     atomic.LoadUint64(&w.failed),
+		Batches:    atomic.LoadUint64(&w.batches),
+	}
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+
+	t := time.NewTicker(maxFlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w.flush:
+			w.writeBatch()
+		case <-t.C:
+			w.writeBatch()
+		case <-w.stop:
+			w.writeBatch()
+			return
+		}
+	}
+}
+
+func (w *Writer) drain() []PointRecord {
+	// only take what's queued at the moment, points pushed while
+	// draining belong to the next batch
+	size := len(w.queue)
+	batch := make([]PointRecord, 0, size)
+	for i := 0; i < size; i++ {
+		batch = append(batch, <-w.queue)
+	}
+	return batch
+}
+
+func (w *Writer) writeBatch() {
+	l := wlog.WithField("func", "writeBatch")
+
+	batch := w.drain()
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	t1 := time.Now()
+	err := WriteBatch(ctx, batch)
+	took := time.Since(t1)
+
+	atomic.AddUint64(&w.batches, 1)
+	stats := w.Stats()
+	l = l.WithFields(logrus.Fields{
+		"count":       len(batch),
+		"took":        took.String(),
+		"queue_depth": stats.QueueDepth,
+		"dropped":     stats.Dropped,
+	})
+
+	if err != nil {
+		atomic.AddUint64(&w.failed, uint64(len(batch)))
+		l.WithError(err).Error("error writing track batch")
+		return
+	}
+	atomic.AddUint64(&w.written, uint64(len(batch)))
+	l.Debug("track batch written")
+}
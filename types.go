@@ -1,9 +1,11 @@
 package simwatch
 
 import (
+	"bytes"
 	"encoding/json"
 
 	"github.com/vatsimnerd/geoidx"
+	"github.com/vatsimnerd/simwatch/provider"
 )
 
 type (
@@ -18,6 +20,11 @@ type (
 		PilotFilter   RequestPilotFilter   `json:"pilot_filter"`
 		Bounds        RequestBounds        `json:"bounds"`
 		SubID         RequestSubID         `json:"sub_id"`
+		Seek          RequestSeek          `json:"seek"`
+		Speed         RequestSpeed         `json:"speed"`
+		Events        RequestEvents        `json:"events"`
+		Board         RequestBoard         `json:"board"`
+		Heatmap       RequestHeatmap       `json:"heatmap"`
 	}
 
 	RequestAirportFilter struct {
@@ -32,6 +39,27 @@ type (
 		ID string `json:"id"`
 	}
 
+	RequestSeek struct {
+		TimeStamp int64 `json:"ts"`
+	}
+
+	RequestSpeed struct {
+		Speed float64 `json:"speed"`
+	}
+
+	RequestEvents struct {
+		Types []provider.EventType `json:"types"`
+	}
+
+	RequestBoard struct {
+		ICAO string `json:"icao"`
+	}
+
+	RequestHeatmap struct {
+		provider.HeatmapQuery
+		Format string `json:"format"`
+	}
+
 	Message struct {
 		Type    MessageType `json:"type"`
 		Payload interface{} `json:"payload"`
@@ -44,9 +72,27 @@ type (
 		maxBucket int
 	}
 
-	RequestBounds = geoidx.Rect
+	// RequestBounds is either a single rect or a list of them
+	RequestBounds []geoidx.Rect
 )
 
+func (rb *RequestBounds) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var rect geoidx.Rect
+		if err := json.Unmarshal(data, &rect); err != nil {
+			return err
+		}
+		*rb = RequestBounds{rect}
+		return nil
+	}
+	var rects []geoidx.Rect
+	if err := json.Unmarshal(data, &rects); err != nil {
+		return err
+	}
+	*rb = rects
+	return nil
+}
+
 func (o *ObjectUpdate) reset() {
 	o.Objects = make([]interface{}, 0, o.maxBucket)
 }
@@ -75,13 +121,29 @@ func makeObjectUpdate(etype, otype string, maxBucket int) *ObjectUpdate {
 }
 
 const (
-	RequestTypeBounds         RequestType = "bounds"
-	RequestTypeAirportsFilter RequestType = "airport_filter"
-	RequestTypePilotsFilter   RequestType = "pilot_filter"
-	RequestTypeSubscribeID    RequestType = "sub_id"
-	RequestTypeUnsubscribeID  RequestType = "unsub_id"
-
-	MessageTypeUpdate MessageType = "update"
-	MessageTypeStatus MessageType = "status"
-	MessageTypeError  MessageType = "error"
+	RequestTypeBounds             RequestType = "bounds"
+	RequestTypeAirportsFilter     RequestType = "airport_filter"
+	RequestTypePilotsFilter       RequestType = "pilot_filter"
+	RequestTypeSubscribeID        RequestType = "sub_id"
+	RequestTypeUnsubscribeID      RequestType = "unsub_id"
+	RequestTypePause              RequestType = "pause"
+	RequestTypeResume             RequestType = "resume"
+	RequestTypeSeek               RequestType = "seek"
+	RequestTypeSpeed              RequestType = "speed"
+	RequestTypeSubscribeEvents    RequestType = "sub_events"
+	RequestTypeUnsubscribeEvents  RequestType = "unsub_events"
+	RequestTypeSubscribeBoard     RequestType = "sub_board"
+	RequestTypeUnsubscribeBoard   RequestType = "unsub_board"
+	RequestTypeSubscribeHeatmap   RequestType = "sub_heatmap"
+	RequestTypeUnsubscribeHeatmap RequestType = "unsub_heatmap"
+
+	MessageTypeUpdate  MessageType = "update"
+	MessageTypeStatus  MessageType = "status"
+	MessageTypeError   MessageType = "error"
+	MessageTypeReplay  MessageType = "replay"
+	MessageTypeEvent   MessageType = "event"
+	MessageTypeBoard   MessageType = "board"
+	MessageTypeHeatmap MessageType = "heatmap"
+
+	MessageTypeDataStatus MessageType = "data_status"
 )
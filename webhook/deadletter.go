@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// deadLetter appends failed deliveries to a JSON-lines file
+// so they can be inspected or replayed manually
+type deadLetter struct {
+	path string
+	lock sync.Mutex
+}
+
+type deadLetterRecord struct {
+	Time       time.Time       `json:"ts"`
+	DeliveryID string          `json:"delivery_id"`
+	URL        string          `json:"url"`
+	Attempts   int             `json:"attempts"`
+	Error      string          `json:"error"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func (dl *deadLetter) write(dlv *delivery, reason error) {
+	l := log.WithFields(logrus.Fields{
+		"func":        "deadLetter.write",
+		"delivery_id": dlv.id,
+	})
+
+	if dl.path == "" {
+		l.WithError(reason).Warn("dead letter file is not configured, delivery dropped")
+		return
+	}
+
+	rec := deadLetterRecord{
+		Time:       time.Now(),
+		DeliveryID: dlv.id,
+		URL:        dlv.sub.url,
+		Attempts:   dlv.attempts,
+		Error:      reason.Error(),
+		Body:       dlv.body,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		l.WithError(err).Error("error encoding dead letter record")
+		return
+	}
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	f, err := os.OpenFile(dl.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		l.WithError(err).Error("error opening dead letter file")
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		l.WithError(err).Error("error writing dead letter record")
+	}
+}
@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/vatsimnerd/simwatch-providers/merged"
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+const (
+	HeaderEvent     = "X-Simwatch-Event"
+	HeaderDelivery  = "X-Simwatch-Delivery"
+	HeaderSignature = "X-Simwatch-Signature"
+	HeaderTimestamp = "X-Simwatch-Timestamp"
+
+	maxRetryBackoff = 5 * time.Minute
+	eventsChSize    = 4096
+)
+
+var (
+	log = logrus.WithField("module", "webhook")
+)
+
+// Dispatcher delivers provider events to configured webhook urls
+type Dispatcher struct {
+	cfg    config.WebhooksConfig
+	subs   []*subscription
+	client *http.Client
+	dl     *deadLetter
+
+	events     *provider.EventSubscription
+	started    bool
+	deliveries chan *delivery
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+type subscription struct {
+	url     string
+	event   provider.EventType
+	airport string
+	secret  string
+	pilot   func(*merged.Pilot) bool
+}
+
+type delivery struct {
+	id       string
+	sub      *subscription
+	event    provider.Event
+	body     []byte
+	attempts int
+}
+
+func New(cfg config.WebhooksConfig) (*Dispatcher, error) {
+	d := &Dispatcher{
+		cfg:        cfg,
+		subs:       make([]*subscription, 0, len(cfg.Subscriptions)),
+		client:     &http.Client{Timeout: cfg.Timeout},
+		dl:         &deadLetter{path: cfg.DeadLetter},
+		deliveries: make(chan *delivery, eventsChSize),
+		stop:       make(chan struct{}),
+	}
+
+	for i, sc := range cfg.Subscriptions {
+		if sc.URL == "" {
+			return nil, fmt.Errorf("webhook subscription #%d has no url", i)
+		}
+		if sc.Event != "" && sc.Event != "*" && !provider.EventType(sc.Event).IsKnown() {
+			return nil, fmt.Errorf("unknown event '%s' for webhook %s", sc.Event, sc.URL)
+		}
+		sub := &subscription{
+			url:     sc.URL,
+			event:   provider.EventType(sc.Event),
+			airport: strings.ToUpper(sc.Airport),
+			secret:  sc.Secret,
+		}
+		if sc.Pilot != "" {
+			matcher, err := provider.PilotMatcher(sc.Pilot)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pilot query for webhook %s: %w", sc.URL, err)
+			}
+			sub.pilot = matcher
+		}
+		d.subs = append(d.subs, sub)
+	}
+	return d, nil
+}
+
+// Start subscribes to provider events, it's a noop if no
+// subscriptions are configured
+func (d *Dispatcher) Start(p *provider.Provider) {
+	if len(d.subs) == 0 {
+		return
+	}
+
+	log.WithField("count", len(d.subs)).Info("starting webhook dispatcher")
+	d.events = p.SubscribeEvents(eventsChSize)
+	d.startWorkers()
+
+	d.wg.Add(1)
+	go d.dispatch(p)
+}
+
+func (d *Dispatcher) startWorkers() {
+	workers := d.cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	d.started = true
+}
+
+// Stop waits for workers to finish, queued deliveries
+// are dead-lettered
+func (d *Dispatcher) Stop() {
+	if !d.started {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+
+	for {
+		select {
+		case dlv := <-d.deliveries:
+			d.dl.write(dlv, fmt.Errorf("dispatcher stopped"))
+		default:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(p *provider.Provider) {
+	defer d.wg.Done()
+	defer p.UnsubscribeEvents(d.events)
+
+	for {
+		select {
+		case ev := <-d.events.Events():
+			d.enqueue(ev)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(ev provider.Event) {
+	for _, sub := range d.subs {
+		if !sub.matches(ev) {
+			continue
+		}
+		dlv, err := newDelivery(sub, ev)
+		if err != nil {
+			log.WithError(err).Error("error encoding event")
+			continue
+		}
+		select {
+		case d.deliveries <- dlv:
+		default:
+			d.dl.write(dlv, fmt.Errorf("delivery queue is full"))
+		}
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case dlv := <-d.deliveries:
+			d.deliver(dlv)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// deliver posts the event retrying with an exponential backoff
+// until MaxRetries is exceeded, then the delivery is dead-lettered
+func (d *Dispatcher) deliver(dlv *delivery) {
+	l := log.WithFields(logrus.Fields{
+		"func":        "deliver",
+		"url":         dlv.sub.url,
+		"delivery_id": dlv.id,
+		"event":       dlv.event.Type,
+	})
+
+	backoff := d.cfg.RetryBackoff
+	for {
+		dlv.attempts++
+		err := d.post(dlv)
+		if err == nil {
+			l.WithField("attempts", dlv.attempts).Debug("webhook delivered")
+			return
+		}
+
+		if dlv.attempts > d.cfg.MaxRetries {
+			l.WithError(err).Error("webhook delivery failed, giving up")
+			d.dl.write(dlv, err)
+			return
+		}
+
+		l.WithError(err).WithField("backoff", backoff).Debug("webhook delivery failed, retrying")
+		select {
+		case <-time.After(backoff):
+		case <-d.stop:
+			d.dl.write(dlv, fmt.Errorf("dispatcher stopped: %w", err))
+			return
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) post(dlv *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, dlv.sub.url, bytes.NewReader(dlv.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(dlv.event.Type))
+	req.Header.Set(HeaderDelivery, dlv.id)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, ts)
+	if dlv.sub.secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(dlv.sub.secret, ts, dlv.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign computes a hex encoded HMAC-SHA256 of the timestamp, a dot and
+// the body. Receivers are expected to compare it to X-Simwatch-Signature
+// and reject deliveries with X-Simwatch-Timestamp too far in the past.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDelivery(sub *subscription, ev provider.Event) (*delivery, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery{
+		id:    uuid.New().String(),
+		sub:   sub,
+		event: ev,
+		body:  body,
+	}, nil
+}
+
+func (s *subscription) matches(ev provider.Event) bool {
+	if s.event != "" && s.event != "*" && s.event != ev.Type {
+		return false
+	}
+
+	if s.airport != "" {
+		if ev.Airport != s.airport {
+			// pilot events without an airport still match
+			// their flight plan departure and arrival
+			if ev.Pilot == nil || ev.Pilot.FlightPlan == nil {
+				return false
+			}
+			fp := ev.Pilot.FlightPlan
+			if fp.Departure != s.airport && fp.Arrival != s.airport {
+				return false
+			}
+		}
+	}
+
+	if s.pilot != nil {
+		if ev.Pilot == nil || !s.pilot(ev.Pilot) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vatsimnerd/simwatch/config"
+	"github.com/vatsimnerd/simwatch/provider"
+)
+
+type receivedHook struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+// receiver records requests and answers with the statuses given,
+// the last one is repeated
+type receiver struct {
+	srv      *httptest.Server
+	statuses []int
+	hooks    []receivedHook
+	received chan struct{}
+	lock     sync.Mutex
+}
+
+func newReceiver(statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses, received: make(chan struct{}, 100)}
+	rcv.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.lock.Lock()
+		rcv.hooks = append(rcv.hooks, receivedHook{header: r.Header, body: body, at: time.Now()})
+		idx := len(rcv.hooks) - 1
+		if idx >= len(rcv.statuses) {
+			idx = len(rcv.statuses) - 1
+		}
+		status := rcv.statuses[idx]
+		rcv.lock.Unlock()
+		w.WriteHeader(status)
+		rcv.received <- struct{}{}
+	}))
+	return rcv
+}
+
+func (rcv *receiver) wait(t *testing.T, count int) []receivedHook {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-rcv.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d requests, got %d", count, i)
+		}
+	}
+	rcv.lock.Lock()
+	defer rcv.lock.Unlock()
+	return append([]receivedHook{}, rcv.hooks...)
+}
+
+func testConfig(t *testing.T, url string) config.WebhooksConfig {
+	return config.WebhooksConfig{
+		Subscriptions: []config.WebhookSubscription{
+			{URL: url, Event: string(provider.EventTakeoff), Airport: "egll", Secret: "s3cr3t"},
+		},
+		Workers:      1,
+		Timeout:      time.Second,
+		MaxRetries:   2,
+		RetryBackoff: 20 * time.Millisecond,
+		DeadLetter:   filepath.Join(t.TempDir(), "dead.jsonl"),
+	}
+}
+
+func startDispatcher(t *testing.T, cfg config.WebhooksConfig) *Dispatcher {
+	t.Helper()
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.startWorkers()
+	return d
+}
+
+func readDeadLetters(t *testing.T, path string) []deadLetterRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := make([]deadLetterRecord, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+var takeoff = provider.Event{Type: provider.EventTakeoff, Callsign: "AAA1", Airport: "EGLL"}
+
+func TestDeliverySignature(t *testing.T) {
+	rcv := newReceiver(http.StatusOK)
+	defer rcv.srv.Close()
+
+	d := startDispatcher(t, testConfig(t, rcv.srv.URL))
+	defer d.Stop()
+
+	// neither event type nor airport match
+	d.enqueue(provider.Event{Type: provider.EventLanding, Airport: "EGLL"})
+	d.enqueue(provider.Event{Type: provider.EventTakeoff, Airport: "EGKK"})
+	d.enqueue(takeoff)
+
+	hooks := rcv.wait(t, 1)
+	if len(hooks) != 1 {
+		t.Fatalf("expected a single delivery, got %d", len(hooks))
+	}
+	hook := hooks[0]
+
+	if hook.header.Get(HeaderEvent) != string(provider.EventTakeoff) {
+		t.Errorf("unexpected event header %q", hook.header.Get(HeaderEvent))
+	}
+	if hook.header.Get(HeaderDelivery) == "" {
+		t.Error("delivery id is missing")
+	}
+	ts := hook.header.Get(HeaderTimestamp)
+	ux, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(ux, 0)) > time.Minute {
+		t.Fatalf("invalid timestamp %q", ts)
+	}
+
+	expected := "sha256=" + Sign("s3cr3t", ts, hook.body)
+	if hook.header.Get(HeaderSignature) != expected {
+		t.Fatalf("signature mismatch, expected %s got %s", expected, hook.header.Get(HeaderSignature))
+	}
+	// a replayed body with another timestamp doesn't verify
+	if Sign("s3cr3t", strconv.FormatInt(ux+600, 10), hook.body) == Sign("s3cr3t", ts, hook.body) {
+		t.Fatal("signature doesn't cover the timestamp")
+	}
+
+	var ev provider.Event
+	if err := json.Unmarshal(hook.body, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Callsign != "AAA1" {
+		t.Fatalf("unexpected event body %s", hook.body)
+	}
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	rcv := newReceiver(http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	defer rcv.srv.Close()
+
+	cfg := testConfig(t, rcv.srv.URL)
+	d := startDispatcher(t, cfg)
+	defer d.Stop()
+
+	d.enqueue(takeoff)
+	hooks := rcv.wait(t, 3)
+
+	ids := map[string]bool{}
+	for _, h := range hooks {
+		ids[h.header.Get(HeaderDelivery)] = true
+	}
+	if len(ids) != 1 {
+		t.Fatalf("retries must keep the delivery id, got %v", ids)
+	}
+
+	// the backoff doubles after every attempt
+	if gap := hooks[1].at.Sub(hooks[0].at); gap < cfg.RetryBackoff {
+		t.Errorf("first retry came after %v, expected at least %v", gap, cfg.RetryBackoff)
+	}
+	if gap := hooks[2].at.Sub(hooks[1].at); gap < 2*cfg.RetryBackoff {
+		t.Errorf("second retry came after %v, expected at least %v", gap, 2*cfg.RetryBackoff)
+	}
+
+	if recs := readDeadLetters(t, cfg.DeadLetter); len(recs) != 0 {
+		t.Fatalf("delivered hook was dead-lettered: %v", recs)
+	}
+}
+
+func TestDeliveryDeadLetter(t *testing.T) {
+	rcv := newReceiver(http.StatusInternalServerError)
+	defer rcv.srv.Close()
+
+	cfg := testConfig(t, rcv.srv.URL)
+	d := startDispatcher(t, cfg)
+
+	d.enqueue(takeoff)
+	rcv.wait(t, cfg.MaxRetries+1)
+	// the dead letter is written right after the last attempt
+	d.Stop()
+
+	recs := readDeadLetters(t, cfg.DeadLetter)
+	if len(recs) != 1 {
+		t.Fatalf("expected a dead letter record, got %d", len(recs))
+	}
+	if recs[0].Attempts != cfg.MaxRetries+1 || recs[0].URL != rcv.srv.URL {
+		t.Fatalf("unexpected dead letter record %+v", recs[0])
+	}
+}
+
+func TestStopDeadLettersQueued(t *testing.T) {
+	// the receiver never answers in time
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := testConfig(t, srv.URL)
+	cfg.Timeout = 50 * time.Millisecond
+	cfg.RetryBackoff = time.Minute
+	d := startDispatcher(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		d.enqueue(takeoff)
+	}
+	d.Stop()
+
+	if recs := readDeadLetters(t, cfg.DeadLetter); len(recs) != 3 {
+		t.Fatalf("expected 3 dead letter records, got %d", len(recs))
+	}
+}
+
+func TestUnknownEvent(t *testing.T) {
+	cfg := config.WebhooksConfig{
+		Subscriptions: []config.WebhookSubscription{{URL: "http://localhost/hook", Event: "take_off"}},
+	}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected unknown event to be rejected")
+	}
+
+	cfg.Subscriptions[0].Event = "*"
+	if _, err := New(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}